@@ -0,0 +1,226 @@
+// Copyright (C) 2017 JT Olds
+// See LICENSE for copying information
+
+// Package accept parses and negotiates Accept, Accept-Language, and
+// Accept-Encoding headers. It's shared by whparse, which documents the
+// rules, and wherr, so both agree on them.
+package accept
+
+import (
+	"fmt"
+	"mime"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Preference is one element of an Accept-style header. See
+// whparse.Preference.
+type Preference struct {
+	Value  string
+	Params map[string]string
+	Q      float64
+}
+
+// Kind says which header is being parsed.
+type Kind int
+
+const (
+	Accept Kind = iota
+	AcceptLanguage
+	AcceptEncoding
+)
+
+// Parse parses header into preferences, most preferred first, sorted by
+// quality value, then specificity, then order in the header. If strict is
+// false, malformed elements are skipped instead of being an error.
+func Parse(header string, kind Kind, strict bool) (
+	[]Preference, error) {
+	var prefs []Preference
+	for _, elem := range strings.Split(header, ",") {
+		elem = strings.TrimSpace(elem)
+		if elem == "" {
+			continue
+		}
+		pref, err := parsePreference(elem, kind)
+		if err != nil {
+			if strict {
+				return nil, err
+			}
+			continue
+		}
+		prefs = append(prefs, pref)
+	}
+	sort.SliceStable(prefs, func(i, j int) bool {
+		if prefs[i].Q != prefs[j].Q {
+			return prefs[i].Q > prefs[j].Q
+		}
+		return specificity(prefs[i], kind) > specificity(prefs[j], kind)
+	})
+	return prefs, nil
+}
+
+func parsePreference(elem string, kind Kind) (Preference, error) {
+	pref := Preference{Q: 1}
+	var params map[string]string
+	if kind == Accept {
+		mediaType, p, err := mime.ParseMediaType(elem)
+		if err != nil {
+			return Preference{}, fmt.Errorf("invalid media range %#v", elem)
+		}
+		slash := strings.IndexByte(mediaType, '/')
+		if slash < 0 || (mediaType[:slash] == "*" &&
+			mediaType[slash+1:] != "*") {
+			return Preference{}, fmt.Errorf("invalid media range %#v", elem)
+		}
+		pref.Value, params = mediaType, p
+	} else {
+		parts := strings.Split(elem, ";")
+		pref.Value = strings.ToLower(strings.TrimSpace(parts[0]))
+		if !validToken(pref.Value, kind) {
+			return Preference{}, fmt.Errorf("invalid value %#v", elem)
+		}
+		params = map[string]string{}
+		for _, param := range parts[1:] {
+			kv := strings.SplitN(param, "=", 2)
+			if len(kv) != 2 {
+				return Preference{}, fmt.Errorf("invalid parameter in %#v", elem)
+			}
+			params[strings.ToLower(strings.TrimSpace(kv[0]))] =
+				strings.TrimSpace(kv[1])
+		}
+	}
+
+	if q, ok := params["q"]; ok {
+		delete(params, "q")
+		val, err := strconv.ParseFloat(q, 64)
+		if err != nil || val < 0 || val > 1 {
+			return Preference{}, fmt.Errorf("invalid quality value in %#v",
+				elem)
+		}
+		pref.Q = val
+	}
+	if kind == Accept && len(params) > 0 {
+		pref.Params = params
+	}
+	return pref, nil
+}
+
+func validToken(val string, kind Kind) bool {
+	if val == "" {
+		return false
+	}
+	for _, c := range val {
+		switch {
+		case c >= 'a' && c <= 'z', c >= '0' && c <= '9', c == '*':
+		case c == '-' && kind == AcceptLanguage:
+		case strings.ContainsRune("!#$%&'+-.^_`|~", c) &&
+			kind == AcceptEncoding:
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// specificity ranks how specific a preference is, for sorting.
+func specificity(pref Preference, kind Kind) int {
+	switch kind {
+	case Accept:
+		switch {
+		case pref.Value == "*/*":
+			return 0
+		case strings.HasSuffix(pref.Value, "/*"):
+			return 1
+		}
+		return 2 + len(pref.Params)
+	case AcceptLanguage:
+		if pref.Value == "*" {
+			return 0
+		}
+		return 1 + strings.Count(pref.Value, "-")
+	}
+	if pref.Value == "*" {
+		return 0
+	}
+	return 1
+}
+
+// matchSpecificity returns how specifically pref matches offer, or -1 if it
+// doesn't match. The results are comparable only for the same offer.
+func matchSpecificity(pref Preference, offer string, kind Kind) int {
+	switch kind {
+	case Accept:
+		mediaType, params, err := mime.ParseMediaType(offer)
+		if err != nil {
+			return -1
+		}
+		switch {
+		case pref.Value == "*/*":
+		case strings.HasSuffix(pref.Value, "/*"):
+			if !strings.HasPrefix(mediaType, pref.Value[:len(pref.Value)-1]) {
+				return -1
+			}
+		case pref.Value != mediaType:
+			return -1
+		}
+		for name, val := range pref.Params {
+			if !strings.EqualFold(params[name], val) {
+				return -1
+			}
+		}
+		return specificity(pref, kind)
+	case AcceptLanguage:
+		offer = strings.ToLower(offer)
+		switch {
+		case pref.Value == "*":
+			return 0
+		case offer == pref.Value || strings.HasPrefix(offer, pref.Value+"-"):
+			// direct matches are more specific than any fallback.
+			return 100 + specificity(pref, kind)
+		case strings.HasPrefix(pref.Value, offer+"-"):
+			// a fallback from a more specific range is better the closer
+			// the offer is to the range.
+			return 1 + strings.Count(offer, "-")
+		}
+		return -1
+	}
+	switch {
+	case pref.Value == "*":
+		return 0
+	case pref.Value == strings.ToLower(offer):
+		return 1
+	}
+	return -1
+}
+
+// Negotiate returns the offer header prefers most, or false if none are
+// acceptable. See whparse.NegotiateContentType and friends for the rules.
+func Negotiate(header string, kind Kind, offers []string) (
+	string, bool) {
+	if len(offers) == 0 {
+		return "", false
+	}
+	if strings.TrimSpace(header) == "" {
+		return offers[0], true
+	}
+	prefs, _ := Parse(header, kind, false)
+
+	best, bestQ := "", 0.0
+	for _, offer := range offers {
+		q, s := 0.0, -1
+		for _, pref := range prefs {
+			if ms := matchSpecificity(pref, offer, kind); ms > s {
+				q, s = pref.Q, ms
+			}
+		}
+		if s < 0 && kind == AcceptEncoding &&
+			strings.EqualFold(offer, "identity") {
+			q = 1
+		}
+		if q > bestQ {
+			best, bestQ = offer, q
+		}
+	}
+	return best, bestQ > 0
+}
@@ -13,6 +13,7 @@ import (
 	"golang.org/x/net/context"
 	"gopkg.in/webhelp.v1"
 	"gopkg.in/webhelp.v1/whcompat"
+	"gopkg.in/webhelp.v1/whmon"
 	"gopkg.in/webhelp.v1/whroute"
 )
 
@@ -46,25 +47,52 @@ var (
 )
 
 // ErrorClass creates a new subclass of HTTPError using the given HTTP status
-// code
+// code. The class has the MessageKey StatusMessageKey(code), so a Catalog can
+// translate its errors.
 func ErrorClass(code int) *errors.ErrorClass {
 	msg := http.StatusText(code)
 	if msg == "" {
 		msg = "Unknown error"
 	}
-	return HTTPError.NewClass(msg, errhttp.SetStatusCode(code))
+	return HTTPError.NewClass(msg, errhttp.SetStatusCode(code),
+		MessageKey(StatusMessageKey(code)))
 }
 
 // Handle uses the provided error handler given via HandleWith
 // to handle the error, falling back to a built in default if not provided.
+// The default handler picks the status code with StatusCode, so errors
+// mapped with Register get the right status, and localizes the message with
+// Message.
+//
+// If w is a whmon.ResponseWriter (see whmon.MonitorResponse) that has already
+// written its headers, the error can no longer be reported without
+// corrupting the response. In that case Handle logs the error and aborts the
+// connection by panicking with http.ErrAbortHandler, which net/http
+// recovers from silently.
 func Handle(w http.ResponseWriter, r *http.Request, err error) {
+	AbortIfStarted(w, err)
 	if handler, ok := whcompat.Context(r).Value(errHandler).(Handler); ok {
 		handler.HandleError(w, r, err)
 		return
 	}
+	if !HasBody(err) {
+		log.Printf("client closed request: %v", err)
+		w.WriteHeader(StatusCode(err))
+		return
+	}
 	log.Printf("error: %v", err)
-	http.Error(w, errhttp.GetErrorBody(err),
-		errhttp.GetStatusCode(err, http.StatusInternalServerError))
+	http.Error(w, Message(r, err), StatusCode(err))
+}
+
+// AbortIfStarted logs err and panics with http.ErrAbortHandler if w is a
+// whmon.ResponseWriter that has already written its headers. Otherwise it
+// returns normally. Error handlers that are invoked directly instead of
+// through Handle can use this to get the same behavior.
+func AbortIfStarted(w http.ResponseWriter, err error) {
+	if rw, ok := w.(whmon.ResponseWriter); ok && rw.WroteHeader() {
+		log.Printf("error after response started, aborting: %v", err)
+		panic(http.ErrAbortHandler)
+	}
 }
 
 // Handlers handle errors. After HandleError returns, it's assumed a response
@@ -4,6 +4,7 @@
 package wherr_test
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 
@@ -47,3 +48,13 @@ func Example() {
 	whlog.ListenAndServe(":0", wherr.HandleWith(wherr.HandlerFunc(ErrorHandler),
 		Routes()))
 }
+
+var ErrOutOfStock = errors.New("out of stock")
+
+func ExampleRegister() {
+	// Handlers can now return ErrOutOfStock, or errors wrapping it, and the
+	// error handler will see a 409 status code.
+	wherr.Register(ErrOutOfStock, wherr.Conflict)
+	whlog.ListenAndServe(":0", wherr.HandleWith(wherr.HandlerFunc(ErrorHandler),
+		Routes()))
+}
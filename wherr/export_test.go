@@ -0,0 +1,17 @@
+// Copyright (C) 2017 JT Olds
+// See LICENSE for copying information
+
+package wherr
+
+// SaveRegistry returns a func that restores the registry to its current
+// state, so tests can register errors without affecting each other.
+func SaveRegistry() (restore func()) {
+	registryMtx.Lock()
+	saved := append([]registration(nil), registry...)
+	registryMtx.Unlock()
+	return func() {
+		registryMtx.Lock()
+		registry = saved
+		registryMtx.Unlock()
+	}
+}
@@ -0,0 +1,81 @@
+// Copyright (C) 2017 JT Olds
+// See LICENSE for copying information
+
+package wherr
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"sort"
+)
+
+var (
+	// HTMLHandler provides a wherr.Handler that renders a minimal HTML error
+	// page. Field errors attached with NewValidationError or Validation are
+	// listed per field. Messages are localized with Message and
+	// LocalizedFieldMap.
+	HTMLHandler = HandlerFunc(htmlHandler)
+
+	htmlErrorTmpl = template.Must(template.New("").Parse(`<!DOCTYPE html>
+<html>
+<head><title>{{ .Status }} {{ .StatusText }}</title></head>
+<body>
+<h1>{{ .StatusText }}</h1>
+<p>{{ .Message }}</p>
+{{- if .Fields }}
+<dl>
+{{- range .Fields }}
+<dt>{{ .Name }}</dt>
+{{- range .Errors }}
+<dd>{{ .Message }}</dd>
+{{- end }}
+{{- end }}
+</dl>
+{{- end }}
+</body>
+</html>
+`))
+)
+
+type htmlField struct {
+	Name   string
+	Errors []FieldError
+}
+
+func htmlHandler(w http.ResponseWriter, r *http.Request, err error) {
+	status := StatusCode(err)
+	if !HasBody(err) {
+		log.Printf("client closed request: %v", err)
+		w.WriteHeader(status)
+		return
+	}
+	log.Printf("error: %v", err)
+
+	fieldMap := LocalizedFieldMap(r, err)
+	fields := make([]htmlField, 0, len(fieldMap))
+	for name, errs := range fieldMap {
+		fields = append(fields, htmlField{Name: name, Errors: errs})
+	}
+	sort.Slice(fields, func(i, j int) bool {
+		return fields[i].Name < fields[j].Name
+	})
+
+	var out bytes.Buffer
+	terr := htmlErrorTmpl.Execute(&out, map[string]interface{}{
+		"Status":     status,
+		"StatusText": http.StatusText(status),
+		"Message":    Message(r, err),
+		"Fields":     fields})
+	if terr != nil {
+		log.Printf("failed rendering error page: %v", terr)
+		http.Error(w, Message(r, err), status)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Content-Length", fmt.Sprint(out.Len()))
+	w.WriteHeader(status)
+	w.Write(out.Bytes())
+}
@@ -0,0 +1,205 @@
+// Copyright (C) 2017 JT Olds
+// See LICENSE for copying information
+
+package wherr
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/spacemonkeygo/errors"
+	"golang.org/x/net/context"
+	"gopkg.in/webhelp.v1"
+	"gopkg.in/webhelp.v1/internal/accept"
+	"gopkg.in/webhelp.v1/whcompat"
+	"gopkg.in/webhelp.v1/whroute"
+)
+
+// DefaultLocale is the language untranslated messages are written in.
+const DefaultLocale = "en"
+
+var (
+	messageKey = errors.GenSym()
+
+	catalogKey = webhelp.GenSym()
+	localeKey  = webhelp.GenSym()
+)
+
+type messageInfo struct {
+	key    string
+	params []interface{}
+}
+
+// MessageKey returns an error option that attaches a translation key and
+// parameters to an error or error class. Error handlers look the key up in
+// the Catalog registered with TranslateWith, and fall back to the English
+// error message if there's no translation.
+//
+//   var InvalidEmail = wherr.BadRequest.NewClass("invalid email",
+//     wherr.MessageKey("email.invalid"))
+//
+//   err := wherr.NotFound.NewWith("no such user",
+//     wherr.MessageKey("user.missing", name))
+//
+func MessageKey(key string, params ...interface{}) errors.ErrorOption {
+	return errors.SetData(messageKey, messageInfo{key: key, params: params})
+}
+
+// StatusMessageKey returns the message key of classes created with
+// ErrorClass, like "status.404", which includes all the built-in classes
+// such as NotFound. Catalog entries for it take no parameters.
+func StatusMessageKey(code int) string {
+	return fmt.Sprintf("status.%d", code)
+}
+
+// Catalog translates message keys into localized messages.
+type Catalog interface {
+	// Translate returns the message for key in the given locale, formatted
+	// with params, and ok = false if there is no such translation.
+	Translate(locale, key string, params ...interface{}) (msg string, ok bool)
+}
+
+// MapCatalog is a Catalog that maps locales to message keys to fmt format
+// strings, like:
+//
+//   wherr.MapCatalog{
+//     "de": {"user.missing": "Benutzer %s nicht gefunden"},
+//     "fr": {"user.missing": "Utilisateur %s introuvable"},
+//   }
+//
+// Locales are matched case-insensitively.
+type MapCatalog map[string]map[string]string
+
+// Translate implements Catalog.
+func (c MapCatalog) Translate(locale, key string, params ...interface{}) (
+	string, bool) {
+	messages, ok := c[locale]
+	if !ok {
+		for name, m := range c {
+			if strings.EqualFold(name, locale) {
+				messages = m
+				break
+			}
+		}
+	}
+	format, ok := messages[key]
+	if !ok {
+		return "", false
+	}
+	if len(params) == 0 {
+		return format, true
+	}
+	return fmt.Sprintf(format, params...), true
+}
+
+// TranslateWith binds the given Catalog to the request contexts that pass
+// through the given http.Handler, so that the error handlers in webhelp
+// localize error messages.
+func TranslateWith(c Catalog, h http.Handler) http.Handler {
+	return whroute.HandlerFunc(h,
+		func(w http.ResponseWriter, r *http.Request) {
+			ctx := context.WithValue(whcompat.Context(r), catalogKey, c)
+			h.ServeHTTP(w, whcompat.WithContext(r, ctx))
+		})
+}
+
+// WithLocale returns a new context that prefers the given locale over the
+// request's Accept-Language header when translating messages.
+func WithLocale(ctx context.Context, locale string) context.Context {
+	return context.WithValue(ctx, localeKey, locale)
+}
+
+// Locales returns the locales r prefers, most preferred first. A locale bound
+// with WithLocale comes first, followed by the Accept-Language header
+// entries in order of preference, lowercased.
+func Locales(r *http.Request) []string {
+	var locales []string
+	if locale, ok := whcompat.Context(r).Value(localeKey).(string); ok {
+		locales = append(locales, locale)
+	}
+	return append(locales,
+		acceptLanguages(r.Header.Get("Accept-Language"))...)
+}
+
+// Message returns the user-facing message for err, like ErrorBody, but
+// translated for r if err has a MessageKey and a Catalog was registered
+// with TranslateWith. Errors from the built-in classes, and errors they're
+// mapped to with Register, have the key StatusMessageKey(code), so a
+// Catalog can translate them all. For each preferred locale, less specific
+// variants are tried too, so "en-GB" falls back to "en".
+func Message(r *http.Request, err error) string {
+	body := ErrorBody(err)
+	if body == "" {
+		return body
+	}
+	info, ok := errors.GetData(err, messageKey).(messageInfo)
+	if !ok {
+		reg := lookup(err)
+		if reg == nil || reg.message == nil {
+			return body
+		}
+		info = *reg.message
+	}
+	if msg, ok := translate(r, info.key, info.params...); ok {
+		return msg
+	}
+	return body
+}
+
+// LocalizedFieldErrors is like FieldErrors, but field error messages are
+// translated for r using the key "field.<code>", with the field name as the
+// only parameter. Untranslated field errors keep their original message.
+func LocalizedFieldErrors(r *http.Request, err error) []FieldError {
+	fields := FieldErrors(err)
+	if len(fields) == 0 {
+		return nil
+	}
+	rv := make([]FieldError, 0, len(fields))
+	for _, field := range fields {
+		if msg, ok := translate(r, "field."+field.Code, field.Field); ok {
+			field.Message = msg
+		}
+		rv = append(rv, field)
+	}
+	return rv
+}
+
+// LocalizedFieldMap is like FieldMap but uses LocalizedFieldErrors.
+func LocalizedFieldMap(r *http.Request, err error) map[string][]FieldError {
+	return groupFields(LocalizedFieldErrors(r, err))
+}
+
+func translate(r *http.Request, key string, params ...interface{}) (
+	string, bool) {
+	catalog, ok := whcompat.Context(r).Value(catalogKey).(Catalog)
+	if !ok {
+		return "", false
+	}
+	for _, locale := range append(Locales(r), DefaultLocale) {
+		for locale != "" {
+			if msg, ok := catalog.Translate(locale, key, params...); ok {
+				return msg, true
+			}
+			idx := strings.LastIndex(locale, "-")
+			if idx < 0 {
+				break
+			}
+			locale = locale[:idx]
+		}
+	}
+	return "", false
+}
+
+// acceptLanguages returns the acceptable locales in header, most preferred
+// first, lowercased.
+func acceptLanguages(header string) []string {
+	prefs, _ := accept.Parse(header, accept.AcceptLanguage, false)
+	locales := make([]string, 0, len(prefs))
+	for _, pref := range prefs {
+		if pref.Value != "*" && pref.Q > 0 {
+			locales = append(locales, pref.Value)
+		}
+	}
+	return locales
+}
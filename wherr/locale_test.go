@@ -0,0 +1,76 @@
+// Copyright (C) 2017 JT Olds
+// See LICENSE for copying information
+
+package wherr_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"gopkg.in/webhelp.v1/whcompat"
+	"gopkg.in/webhelp.v1/wherr"
+)
+
+func TestMessage(t *testing.T) {
+	catalog := wherr.MapCatalog{
+		"de": {"user.missing": "Benutzer %s nicht gefunden",
+			"status.404": "Nicht gefunden"},
+		"fr":    {"user.missing": "Utilisateur %s introuvable"},
+		"pt-BR": {"user.missing": "Usuário %s não encontrado"},
+	}
+	err := wherr.NotFound.NewWith("no such user",
+		wherr.MessageKey("user.missing", "jt"))
+
+	message := func(acceptLanguage, locale string) (msg string) {
+		handler := wherr.TranslateWith(catalog, http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				if locale != "" {
+					r = whcompat.WithContext(r,
+						wherr.WithLocale(whcompat.Context(r), locale))
+				}
+				msg = wherr.Message(r, err)
+			}))
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Header.Set("Accept-Language", acceptLanguage)
+		handler.ServeHTTP(httptest.NewRecorder(), r)
+		return msg
+	}
+
+	for _, test := range []struct {
+		acceptLanguage, locale, expected string
+	}{
+		{"de-AT, fr;q=0.5", "", "Benutzer jt nicht gefunden"},
+		{"es, fr;q=0.8, de;q=0.3", "", "Utilisateur jt introuvable"},
+		{"de", "fr-CA", "Utilisateur jt introuvable"},
+		{"es", "", "no such user"},
+		{"DE-at", "", "Benutzer jt nicht gefunden"},
+		{"pt-br", "", "Usuário jt não encontrado"},
+		{"", "PT-BR", "Usuário jt não encontrado"},
+		{"", "", "no such user"},
+		{"fr;q=0, de", "", "Benutzer jt nicht gefunden"},
+	} {
+		if msg := message(test.acceptLanguage, test.locale); msg != test.expected {
+			t.Errorf("%q/%q: expected %q, got %q", test.acceptLanguage,
+				test.locale, test.expected, msg)
+		}
+	}
+
+	// built-in classes and registry-mapped errors have status keys.
+	for _, test := range []struct {
+		err                      error
+		acceptLanguage, expected string
+	}{
+		{wherr.NotFound.New("no such page"), "de", "Nicht gefunden"},
+		{wherr.NotFound.New("no such page"), "fr", "no such page"},
+		{os.ErrNotExist, "de", "Nicht gefunden"},
+		{os.ErrNotExist, "fr", "Not Found"},
+	} {
+		err = test.err
+		if msg := message(test.acceptLanguage, ""); msg != test.expected {
+			t.Errorf("%v/%q: expected %q, got %q", test.err,
+				test.acceptLanguage, test.expected, msg)
+		}
+	}
+}
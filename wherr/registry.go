@@ -0,0 +1,148 @@
+// Copyright (C) 2017 JT Olds
+// See LICENSE for copying information
+
+package wherr
+
+import (
+	"database/sql"
+	stderrors "errors"
+	"net/http"
+	"os"
+	"reflect"
+	"sync"
+
+	"github.com/spacemonkeygo/errors"
+	"github.com/spacemonkeygo/errors/errhttp"
+	"golang.org/x/net/context"
+)
+
+// StatusClientClosedRequest is the nonstandard status code (popularized by
+// nginx) used when the client went away before a response could be sent.
+const StatusClientClosedRequest = 499
+
+var (
+	// ClientClosedRequest is used for requests the client canceled. Handlers
+	// in webhelp log these but do not write a response body.
+	ClientClosedRequest = HTTPError.NewClass("Client Closed Request",
+		errhttp.SetStatusCode(StatusClientClosedRequest))
+
+	registryMtx sync.RWMutex
+	registry    []registration
+)
+
+type registration struct {
+	match   func(err error) bool
+	class   *errors.ErrorClass
+	code    int
+	message *messageInfo
+}
+
+func init() {
+	Register(os.ErrNotExist, NotFound)
+	Register(os.ErrPermission, Forbidden)
+	Register(sql.ErrNoRows, NotFound)
+	Register(context.DeadlineExceeded, GatewayTimeout)
+	Register(context.Canceled, ClientClosedRequest)
+}
+
+// Register maps errors that match target with errors.Is to the given
+// HTTPError class. Registrations made later take precedence over earlier
+// ones, so the defaults (os.ErrNotExist, os.ErrPermission, sql.ErrNoRows,
+// context.DeadlineExceeded, and context.Canceled) can be overridden.
+func Register(target error, class *errors.ErrorClass) {
+	RegisterFunc(func(err error) bool {
+		return stderrors.Is(err, target)
+	}, class)
+}
+
+// RegisterAs maps errors that match target's type with errors.As to the
+// given HTTPError class. target should be a nil pointer of the type to
+// match, like (*os.PathError)(nil) or (*MyError)(nil).
+func RegisterAs(target interface{}, class *errors.ErrorClass) {
+	typ := reflect.TypeOf(target)
+	if typ == nil || typ.Kind() != reflect.Ptr {
+		panic("wherr: RegisterAs target must be a pointer type")
+	}
+	RegisterFunc(func(err error) bool {
+		return stderrors.As(err, reflect.New(typ).Interface())
+	}, class)
+}
+
+// RegisterFunc maps errors for which match returns true to the given
+// HTTPError class.
+func RegisterFunc(match func(err error) bool, class *errors.ErrorClass) {
+	sample := class.NewWith("")
+	reg := registration{
+		match: match,
+		class: class,
+		code:  errhttp.GetStatusCode(sample, http.StatusInternalServerError)}
+	if info, ok := errors.GetData(sample, messageKey).(messageInfo); ok {
+		reg.message = &info
+	}
+	registryMtx.Lock()
+	defer registryMtx.Unlock()
+	registry = append(registry, reg)
+}
+
+// Classify returns the HTTPError class that applies to err. If err is already
+// an HTTPError, its own class is returned. Otherwise, the registry is
+// consulted, for err and everything it wraps. Classify returns nil if no
+// class applies.
+func Classify(err error) *errors.ErrorClass {
+	if err == nil {
+		return nil
+	}
+	if HTTPError.Contains(err) {
+		return errors.GetClass(err)
+	}
+	if reg := lookup(err); reg != nil {
+		return reg.class
+	}
+	return nil
+}
+
+func lookup(err error) *registration {
+	registryMtx.RLock()
+	defer registryMtx.RUnlock()
+	for e := err; e != nil; e = errors.WrappedErr(e) {
+		for i := len(registry) - 1; i >= 0; i-- {
+			if registry[i].match(e) {
+				return &registry[i]
+			}
+		}
+	}
+	return nil
+}
+
+// StatusCode returns the HTTP status code that should be used for err. An
+// explicit errhttp status code wins, followed by the registry (see Register),
+// and finally http.StatusInternalServerError.
+func StatusCode(err error) int {
+	if code := errhttp.GetStatusCode(err, 0); code != 0 {
+		return code
+	}
+	if reg := lookup(err); reg != nil {
+		return reg.code
+	}
+	return http.StatusInternalServerError
+}
+
+// ErrorBody returns the user-facing message for err. Errors that were only
+// classified through the registry get their status text, so the message of
+// an arbitrary library error isn't exposed. Errors that shouldn't have a
+// response body (see HasBody) get an empty string.
+func ErrorBody(err error) string {
+	if !HasBody(err) {
+		return ""
+	}
+	if errhttp.GetStatusCode(err, 0) == 0 && lookup(err) != nil {
+		return http.StatusText(StatusCode(err))
+	}
+	return errhttp.GetErrorBody(err)
+}
+
+// HasBody returns false if no response body should be written for err, as is
+// the case with ClientClosedRequest errors and context.Canceled.
+func HasBody(err error) bool {
+	return StatusCode(err) != StatusClientClosedRequest
+}
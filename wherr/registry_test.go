@@ -0,0 +1,60 @@
+// Copyright (C) 2017 JT Olds
+// See LICENSE for copying information
+
+package wherr_test
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"golang.org/x/net/context"
+	"gopkg.in/webhelp.v1/wherr"
+)
+
+type quotaError struct{ user string }
+
+func (e *quotaError) Error() string { return "quota exceeded for " + e.user }
+
+func TestStatusCode(t *testing.T) {
+	defer wherr.SaveRegistry()()
+	wherr.RegisterAs((*quotaError)(nil), wherr.Forbidden)
+
+	for _, test := range []struct {
+		err  error
+		code int
+		body string
+	}{
+		{wherr.Conflict.New("already exists"), http.StatusConflict,
+			"already exists"},
+		{os.ErrNotExist, http.StatusNotFound, "Not Found"},
+		{fmt.Errorf("loading: %w", sql.ErrNoRows), http.StatusNotFound,
+			"Not Found"},
+		{context.DeadlineExceeded, http.StatusGatewayTimeout, "Gateway Timeout"},
+		{context.Canceled, wherr.StatusClientClosedRequest, ""},
+		{fmt.Errorf("wrapped: %w", &quotaError{user: "jt"}),
+			http.StatusForbidden, "Forbidden"},
+	} {
+		if code := wherr.StatusCode(test.err); code != test.code {
+			t.Errorf("%v: expected %d, got %d", test.err, test.code, code)
+		}
+		if body := wherr.ErrorBody(test.err); body != test.body {
+			t.Errorf("%v: expected body %q, got %q", test.err, test.body, body)
+		}
+	}
+
+	if wherr.StatusCode(fmt.Errorf("unknown")) != http.StatusInternalServerError {
+		t.Error("expected unknown errors to be internal server errors")
+	}
+}
+
+func TestHandleCanceled(t *testing.T) {
+	w := httptest.NewRecorder()
+	wherr.Handle(w, httptest.NewRequest("GET", "/", nil), context.Canceled)
+	if w.Code != wherr.StatusClientClosedRequest || w.Body.Len() != 0 {
+		t.Fatalf("unexpected response: %d %q", w.Code, w.Body.String())
+	}
+}
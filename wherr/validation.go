@@ -0,0 +1,130 @@
+// Copyright (C) 2017 JT Olds
+// See LICENSE for copying information
+
+package wherr
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/spacemonkeygo/errors"
+)
+
+var (
+	UnprocessableEntity = ErrorClass(http.StatusUnprocessableEntity)
+
+	fieldErrorsKey = errors.GenSym()
+)
+
+// FieldError describes why a single named input field failed validation.
+// Code is a short machine-readable reason (like "required" or "invalid"),
+// and Message is a human-readable explanation.
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func (fe FieldError) String() string {
+	if fe.Message == "" {
+		return fmt.Sprintf("%s: %s", fe.Field, fe.Code)
+	}
+	return fmt.Sprintf("%s: %s", fe.Field, fe.Message)
+}
+
+// NewValidationError returns a new error of the given class (usually
+// BadRequest or UnprocessableEntity) that carries the given field errors.
+// The field errors can be retrieved with FieldErrors.
+func NewValidationError(class *errors.ErrorClass, fields ...FieldError) error {
+	parts := make([]string, 0, len(fields))
+	for _, field := range fields {
+		parts = append(parts, field.String())
+	}
+	return class.NewWith(strings.Join(parts, "; "),
+		errors.SetData(fieldErrorsKey, fields))
+}
+
+// FieldErrors returns the field errors attached to err by NewValidationError
+// or Validation, or nil if there are none.
+func FieldErrors(err error) []FieldError {
+	fields, _ := errors.GetData(err, fieldErrorsKey).([]FieldError)
+	return fields
+}
+
+// FieldMap groups the field errors attached to err by field name, preserving
+// the order they were added in. It returns nil if there are none.
+func FieldMap(err error) map[string][]FieldError {
+	return groupFields(FieldErrors(err))
+}
+
+func groupFields(fields []FieldError) map[string][]FieldError {
+	if len(fields) == 0 {
+		return nil
+	}
+	rv := make(map[string][]FieldError, len(fields))
+	for _, field := range fields {
+		rv[field.Field] = append(rv[field.Field], field)
+	}
+	return rv
+}
+
+// Validation collects field errors while checking input. The zero value is
+// ready to use.
+//
+//   var v wherr.Validation
+//   if !strings.Contains(req.Email, "@") {
+//     v.Add("email", "invalid", "email is invalid")
+//   }
+//   if req.Age <= 0 {
+//     v.Add("age", "range", "age must be positive")
+//   }
+//   if err := v.Err(); err != nil {
+//     wherr.Handle(w, r, err)
+//     return
+//   }
+//
+type Validation struct {
+	fields []FieldError
+}
+
+// Add records a field error.
+func (v *Validation) Add(field, code, message string) {
+	v.fields = append(v.fields,
+		FieldError{Field: field, Code: code, Message: message})
+}
+
+// Addf is like Add but formats the message with fmt.Sprintf.
+func (v *Validation) Addf(field, code, format string, args ...interface{}) {
+	v.Add(field, code, fmt.Sprintf(format, args...))
+}
+
+// Check records a field error if ok is false, and returns ok.
+func (v *Validation) Check(ok bool, field, code, message string) bool {
+	if !ok {
+		v.Add(field, code, message)
+	}
+	return ok
+}
+
+// Fields returns the field errors collected so far.
+func (v *Validation) Fields() []FieldError {
+	return v.fields
+}
+
+// Err returns nil if no field errors were recorded, and otherwise an
+// UnprocessableEntity error carrying all of them.
+func (v *Validation) Err() error {
+	return v.ErrWith(UnprocessableEntity)
+}
+
+// ErrWith is like Err but lets you choose the error class, such as
+// BadRequest.
+func (v *Validation) ErrWith(class *errors.ErrorClass) error {
+	if len(v.fields) == 0 {
+		return nil
+	}
+	fields := make([]FieldError, len(v.fields))
+	copy(fields, v.fields)
+	return NewValidationError(class, fields...)
+}
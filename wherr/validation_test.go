@@ -0,0 +1,45 @@
+// Copyright (C) 2017 JT Olds
+// See LICENSE for copying information
+
+package wherr_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/spacemonkeygo/errors/errhttp"
+	"gopkg.in/webhelp.v1/wherr"
+)
+
+func TestValidation(t *testing.T) {
+	var v wherr.Validation
+	if v.Err() != nil {
+		t.Fatal("expected no error without field errors")
+	}
+	v.Add("email", "invalid", "email is invalid")
+	v.Addf("age", "range", "age must be positive, got %d", -3)
+	v.Add("email", "taken", "email is taken")
+
+	err := v.Err()
+	if !wherr.UnprocessableEntity.Contains(err) {
+		t.Fatalf("unexpected class: %v", err)
+	}
+	if code := errhttp.GetStatusCode(err, 0); code != 422 {
+		t.Fatalf("unexpected status code %d", code)
+	}
+	if fields := wherr.FieldErrors(err); len(fields) != 3 {
+		t.Fatalf("unexpected field errors: %v", fields)
+	}
+	fieldMap := wherr.FieldMap(err)
+	if len(fieldMap["email"]) != 2 || len(fieldMap["age"]) != 1 {
+		t.Fatalf("unexpected field map: %v", fieldMap)
+	}
+
+	err = v.ErrWith(wherr.BadRequest)
+	if errhttp.GetStatusCode(err, 0) != http.StatusBadRequest {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if wherr.FieldMap(wherr.NotFound.New("plain")) != nil {
+		t.Fatal("expected no field map for plain errors")
+	}
+}
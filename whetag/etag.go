@@ -0,0 +1,225 @@
+// Copyright (C) 2017 JT Olds
+// See LICENSE for copying information
+
+// Package whetag provides conditional GET support, so clients that already
+// have the current version of a response get a 304 Not Modified instead of
+// the whole body again.
+//
+// Conditional generates strong ETags by hashing buffered responses, which
+// saves bandwidth but not rendering work. Handlers that can cheaply compute a
+// version identifier or modification time up front can use Check to skip
+// rendering altogether.
+package whetag // import "gopkg.in/webhelp.v1/whetag"
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"gopkg.in/webhelp.v1/whroute"
+)
+
+// Conditional buffers GET and HEAD responses from h. If h responds with a 200
+// and didn't set an ETag header itself, Conditional sets a strong ETag (see
+// StrongETag) computed from the body. If the request's If-None-Match header
+// matches the ETag, or, without If-None-Match, the If-Modified-Since header
+// is no earlier than a Last-Modified header h set, Conditional sends a 304
+// Not Modified response instead of the body. HEAD responses only get an
+// ETag and Content-Length if h writes the body like it would for GET;
+// otherwise they're sent as h left them.
+//
+// If h flushes the response (see http.Flusher), Conditional stops buffering
+// and sends everything as is, so streaming responses keep working but don't
+// get ETags. The http.ResponseWriter h is given doesn't support
+// http.Hijacker or http.CloseNotifier. Other request methods are passed
+// through untouched.
+func Conditional(h http.Handler) http.Handler {
+	return whroute.HandlerFunc(h,
+		func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != "GET" && r.Method != "HEAD" {
+				h.ServeHTTP(w, r)
+				return
+			}
+			bw := &bufferedWriter{w: w}
+			h.ServeHTTP(bw, r)
+			bw.finish(r)
+		})
+}
+
+// Check sets the ETag and Last-Modified response headers to precomputed
+// values, if etag is non-empty and lastModified is non-zero, respectively.
+// If the request is a GET or HEAD request with conditional headers that
+// match, Check writes a 304 Not Modified response and returns true, and the
+// caller should return without rendering anything. Otherwise it returns
+// false and the caller should render the response as usual.
+//
+// etag may be given with or without quotes. Weak ETags must be given with
+// their W/ prefix, like `W/"v1"`.
+func Check(w http.ResponseWriter, r *http.Request, etag string,
+	lastModified time.Time) bool {
+	if etag != "" {
+		etag = quoteETag(etag)
+		w.Header().Set("ETag", etag)
+	}
+	if !lastModified.IsZero() {
+		w.Header().Set("Last-Modified",
+			lastModified.UTC().Format(http.TimeFormat))
+	}
+	if (r.Method != "GET" && r.Method != "HEAD") ||
+		!notModified(r, etag, lastModified) {
+		return false
+	}
+	writeNotModified(w)
+	return true
+}
+
+// StrongETag returns a quoted strong ETag for the given response body.
+func StrongETag(body []byte) string {
+	sum := sha256.Sum256(body)
+	return `"` + base64.RawURLEncoding.EncodeToString(sum[:16]) + `"`
+}
+
+// Matches reports whether the If-None-Match style header value (a list of
+// ETags, or "*") matches etag. Comparison is weak, as RFC 7232 requires for
+// If-None-Match, so W/"x" matches "x".
+func Matches(header, etag string) bool {
+	if etag == "" {
+		return false
+	}
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" ||
+			strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+func quoteETag(etag string) string {
+	if strings.HasPrefix(etag, `"`) || strings.HasPrefix(etag, `W/"`) {
+		return etag
+	}
+	return `"` + etag + `"`
+}
+
+// notModified reports whether the request's conditional headers say the
+// client already has the response identified by etag and lastModified.
+// If-Modified-Since is only considered without If-None-Match.
+func notModified(r *http.Request, etag string, lastModified time.Time) bool {
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		return Matches(inm, etag)
+	}
+	ims := r.Header.Get("If-Modified-Since")
+	if ims == "" || lastModified.IsZero() {
+		return false
+	}
+	t, err := http.ParseTime(ims)
+	if err != nil {
+		return false
+	}
+	return !lastModified.Truncate(time.Second).After(t)
+}
+
+func writeNotModified(w http.ResponseWriter) {
+	h := w.Header()
+	delete(h, "Content-Type")
+	delete(h, "Content-Length")
+	w.WriteHeader(http.StatusNotModified)
+}
+
+// bufferedWriter holds on to the response until finish is called, unless
+// it's flushed first. It implements whmon.ResponseWriter so wherr can still
+// tell whether the response was started.
+type bufferedWriter struct {
+	w           http.ResponseWriter
+	status      int
+	buf         bytes.Buffer
+	passthrough bool
+	written     int64
+}
+
+func (b *bufferedWriter) Header() http.Header { return b.w.Header() }
+
+func (b *bufferedWriter) WriteHeader(sc int) {
+	if b.status != 0 {
+		return
+	}
+	b.status = sc
+	if b.passthrough {
+		b.w.WriteHeader(sc)
+	}
+}
+
+func (b *bufferedWriter) Write(p []byte) (n int, err error) {
+	if b.status == 0 {
+		b.WriteHeader(http.StatusOK)
+	}
+	if b.passthrough {
+		n, err = b.w.Write(p)
+	} else {
+		n, err = b.buf.Write(p)
+	}
+	b.written += int64(n)
+	return n, err
+}
+
+func (b *bufferedWriter) Flush() {
+	if !b.passthrough {
+		b.passthrough = true
+		if b.status != 0 {
+			b.w.WriteHeader(b.status)
+		}
+		b.w.Write(b.buf.Bytes())
+		b.buf.Reset()
+	}
+	if f, ok := b.w.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (b *bufferedWriter) WroteHeader() bool { return b.status != 0 }
+func (b *bufferedWriter) Written() int64    { return b.written }
+
+func (b *bufferedWriter) StatusCode() int {
+	if b.status == 0 {
+		return http.StatusOK
+	}
+	return b.status
+}
+
+func (b *bufferedWriter) finish(r *http.Request) {
+	if b.passthrough {
+		return
+	}
+	status := b.StatusCode()
+	if r.Method == "HEAD" && b.buf.Len() == 0 {
+		// lots of HEAD handlers don't write a body at all, and the hash of an
+		// empty body wouldn't match the GET response's ETag.
+		b.w.WriteHeader(status)
+		return
+	}
+	if status == http.StatusOK {
+		h := b.w.Header()
+		etag := h.Get("ETag")
+		if etag == "" {
+			etag = StrongETag(b.buf.Bytes())
+			h.Set("ETag", etag)
+		}
+		lastModified, _ := http.ParseTime(h.Get("Last-Modified"))
+		if notModified(r, etag, lastModified) {
+			writeNotModified(b.w)
+			return
+		}
+		if h.Get("Content-Length") == "" {
+			h.Set("Content-Length", fmt.Sprint(b.buf.Len()))
+		}
+	}
+	b.w.WriteHeader(status)
+	b.w.Write(b.buf.Bytes())
+}
@@ -0,0 +1,113 @@
+// Copyright (C) 2017 JT Olds
+// See LICENSE for copying information
+
+package whetag_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"gopkg.in/webhelp.v1/whetag"
+)
+
+func TestConditional(t *testing.T) {
+	handler := whetag.Conditional(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, "hello")
+		}))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	etag := w.Header().Get("ETag")
+	if w.Code != 200 || w.Body.String() != "hello" ||
+		etag != whetag.StrongETag([]byte("hello")) {
+		t.Fatalf("unexpected response: %d %q %q", w.Code, etag, w.Body.String())
+	}
+
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("If-None-Match", `"other", `+etag)
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	if w.Code != 304 || w.Body.Len() != 0 {
+		t.Fatalf("expected 304, got %d %q", w.Code, w.Body.String())
+	}
+
+	r = httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("If-None-Match", `"other"`)
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	if w.Code != 200 || w.Body.String() != "hello" {
+		t.Fatalf("expected 200, got %d %q", w.Code, w.Body.String())
+	}
+}
+
+func TestCheck(t *testing.T) {
+	modified := time.Date(2017, 1, 2, 3, 4, 5, 0, time.UTC)
+	rendered := 0
+	handler := whetag.Conditional(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			if whetag.Check(w, r, "v1", modified) {
+				return
+			}
+			rendered++
+			fmt.Fprint(w, "expensive")
+		}))
+
+	for _, test := range []struct {
+		header, value string
+		status        int
+	}{
+		{"", "", 200},
+		{"If-None-Match", `W/"v1"`, 304},
+		{"If-None-Match", `"v2"`, 200},
+		{"If-Modified-Since", modified.Format(http.TimeFormat), 304},
+		{"If-Modified-Since",
+			modified.Add(-time.Hour).Format(http.TimeFormat), 200},
+	} {
+		r := httptest.NewRequest("GET", "/", nil)
+		if test.header != "" {
+			r.Header.Set(test.header, test.value)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		if w.Code != test.status || w.Header().Get("ETag") != `"v1"` {
+			t.Fatalf("%s %s: unexpected response %d %q", test.header,
+				test.value, w.Code, w.Header().Get("ETag"))
+		}
+	}
+	if rendered != 3 {
+		t.Fatalf("expected 3 renders, got %d", rendered)
+	}
+}
+
+func TestConditionalHead(t *testing.T) {
+	handler := whetag.Conditional(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/plain")
+			if r.Method != "HEAD" {
+				fmt.Fprint(w, "hello world")
+			}
+		}))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("HEAD", "/", nil))
+	if w.Code != 200 || w.Header().Get("ETag") != "" ||
+		w.Header().Get("Content-Length") != "" {
+		t.Fatalf("unexpected HEAD response: %d %v", w.Code, w.Header())
+	}
+
+	// handlers that do write the body for HEAD get the same ETag as GET.
+	handler = whetag.Conditional(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, "hello world")
+		}))
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("HEAD", "/", nil))
+	if w.Header().Get("ETag") != whetag.StrongETag([]byte("hello world")) ||
+		w.Header().Get("Content-Length") != "11" {
+		t.Fatalf("unexpected HEAD response: %d %v", w.Code, w.Header())
+	}
+}
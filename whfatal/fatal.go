@@ -6,6 +6,7 @@
 package whfatal // import "gopkg.in/webhelp.v1/whfatal"
 
 import (
+	"log"
 	"net/http"
 
 	"gopkg.in/webhelp.v1/wherr"
@@ -18,10 +19,30 @@ type fatalBehavior func(w http.ResponseWriter, r *http.Request)
 
 // Catch takes a Handler and returns a new one that works with Fatal,
 // whfatal.Redirect, and whfatal.Error. Catch will also catch panics that are
-// wherr.HTTPError errors. Catch should be placed *inside* a whlog.LogRequests
+// wherr.HTTPError errors, or errors wherr.Classify otherwise recognizes (see
+// wherr.Register). Catch should be placed *inside* a whlog.LogRequests
 // handler, wherr.HandleWith handlers, and a few other handlers. Otherwise,
 // the wrapper will be one of the things interrupted by Fatal calls.
+//
+// If the wrapped handler already wrote the response headers when Fatal (or
+// Redirect, Error, or a caught panic) interrupts it, the response can't be
+// replaced anymore, so Catch logs the situation and aborts the connection
+// with http.ErrAbortHandler instead of writing a second response. Fatal(nil)
+// is the exception, as it doesn't try to write anything.
 func Catch(h http.Handler) http.Handler {
+	return catch(h, false)
+}
+
+// CatchPanics is like Catch, but additionally turns all other panics into
+// PanicError errors (with the stack captured, see PanicStack), logs them with
+// their stack, and passes them to wherr.Handle, so the request gets a 500
+// instead of a dropped connection. http.ErrAbortHandler panics are still
+// passed through.
+func CatchPanics(h http.Handler) http.Handler {
+	return catch(h, true)
+}
+
+func catch(h http.Handler, all bool) http.Handler {
 	return whmon.MonitorResponse(whroute.HandlerFunc(h,
 		func(w http.ResponseWriter, r *http.Request) {
 			rw := w.(whmon.ResponseWriter)
@@ -33,14 +54,26 @@ func Catch(h http.Handler) http.Handler {
 				behavior, ok := rec.(fatalBehavior)
 				if !ok {
 					perr, ok := rec.(error)
-					if !ok || !wherr.HTTPError.Contains(perr) {
-						panic(rec)
+					if !ok || wherr.Classify(perr) == nil {
+						if !all || rec == http.ErrAbortHandler {
+							panic(rec)
+						}
+						perr = newPanicError(rec)
+						// PanicError doesn't capture a stack of its own, so
+						// this is the only place the trace gets logged.
+						log.Printf("panic: %v\n%s", rec, PanicStack(perr))
 					}
 					behavior = func(w http.ResponseWriter, r *http.Request) {
 						wherr.Handle(w, r, perr)
 					}
 				}
 				if behavior != nil {
+					if rw.WroteHeader() {
+						log.Printf("fatal after response started (status %d, %d "+
+							"bytes written), aborting: %v", rw.StatusCode(),
+							rw.Written(), rec)
+						panic(http.ErrAbortHandler)
+					}
 					behavior(rw, r)
 				}
 				if !rw.WroteHeader() {
@@ -66,7 +99,8 @@ func Redirect(redirectTo string) {
 }
 
 // Error is like wherr.Handle but panics so that all additional request
-// processing terminates. Implemented with Fatal()
+// processing terminates. Implemented with Fatal(). Field errors attached with
+// wherr.NewValidationError are preserved for the error handler.
 //
 // IMPORTANT: must be used with whfatal.Catch, or else the http.ResponseWriter
 // won't be able to be obtained. Because this requires whfatal.Catch, if
@@ -79,6 +113,16 @@ func Error(err error) {
 	})
 }
 
+// Validate calls Error with v.Err() if v has recorded any field errors, and
+// otherwise returns normally.
+//
+// IMPORTANT: must be used with whfatal.Catch. See the note on Error.
+func Validate(v *wherr.Validation) {
+	if err := v.Err(); err != nil {
+		Error(err)
+	}
+}
+
 // Fatal panics in a way that Catch understands to abort all additional
 // request processing. Once request processing has been aborted, handler is
 // called, if not nil. If handler doesn't write a response, a 500 will
@@ -0,0 +1,86 @@
+// Copyright (C) 2017 JT Olds
+// See LICENSE for copying information
+
+package whfatal_test
+
+import (
+	"bytes"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"gopkg.in/webhelp.v1/wherr"
+	"gopkg.in/webhelp.v1/whfatal"
+)
+
+func TestCatchPanics(t *testing.T) {
+	handler := whfatal.CatchPanics(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			var m map[string]int
+			m["boom"] = 1
+		}))
+
+	var logged bytes.Buffer
+	log.SetOutput(&logged)
+	defer log.SetOutput(os.Stderr)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("unexpected status %d", w.Code)
+	}
+	if !strings.Contains(logged.String(), "nil map") ||
+		!strings.Contains(logged.String(), "fatal_test.go") {
+		t.Fatalf("panic not logged with its stack: %s", logged.String())
+	}
+	if strings.Contains(w.Body.String(), "nil map") {
+		t.Fatalf("panic value leaked to client: %q", w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	wherr.HandleWith(whfatal.DevPanicPages(nil), handler).ServeHTTP(w,
+		httptest.NewRequest("GET", "/dev", nil))
+	body := w.Body.String()
+	if w.Code != http.StatusInternalServerError ||
+		!strings.Contains(body, "nil map") ||
+		!strings.Contains(body, "fatal_test.go") ||
+		!strings.Contains(body, `m[&#34;boom&#34;] = 1`) {
+		t.Fatalf("unexpected panic page: %d %s", w.Code, body)
+	}
+}
+
+func TestCatchRepanics(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Fatal("expected Catch to re-panic")
+		}
+	}()
+	whfatal.Catch(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			panic("boom")
+		})).ServeHTTP(httptest.NewRecorder(),
+		httptest.NewRequest("GET", "/", nil))
+}
+
+func TestErrorAfterHeaders(t *testing.T) {
+	handler := whfatal.Catch(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("partial"))
+			whfatal.Error(wherr.BadRequest.New("too late"))
+		}))
+
+	w := httptest.NewRecorder()
+	func() {
+		defer func() {
+			if rec := recover(); rec != http.ErrAbortHandler {
+				t.Fatalf("expected http.ErrAbortHandler, got %v", rec)
+			}
+		}()
+		handler.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	}()
+	if w.Code != http.StatusOK || w.Body.String() != "partial" {
+		t.Fatalf("response was modified: %d %q", w.Code, w.Body.String())
+	}
+}
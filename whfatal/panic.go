@@ -0,0 +1,216 @@
+// Copyright (C) 2017 JT Olds
+// See LICENSE for copying information
+
+package whfatal
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"os"
+	"runtime/debug"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/spacemonkeygo/errors"
+	"github.com/spacemonkeygo/errors/errhttp"
+	"gopkg.in/webhelp.v1/wherr"
+)
+
+const sourceContext = 5
+
+var (
+	// PanicError is the class of errors CatchPanics creates out of recovered
+	// panics. The panic value is never shown to the client; the response
+	// body is just the status text.
+	PanicError = wherr.InternalServerError.NewClass("Panic",
+		errhttp.SetErrorBody(http.StatusText(http.StatusInternalServerError)))
+
+	panicStackKey = errors.GenSym()
+)
+
+func newPanicError(rec interface{}) error {
+	stack := errors.SetData(panicStackKey, string(debug.Stack()))
+	if err, ok := rec.(error); ok {
+		return PanicError.Wrap(err, stack)
+	}
+	return PanicError.NewWith(fmt.Sprint(rec), stack)
+}
+
+// PanicStack returns the stack trace captured when CatchPanics recovered the
+// panic that err was created from, or "" if err didn't come from a panic.
+func PanicStack(err error) string {
+	stack, _ := errors.GetData(err, panicStackKey).(string)
+	return stack
+}
+
+// DevPanicPages returns a wherr.Handler that renders a detailed HTML page for
+// errors that came from panics recovered by CatchPanics, showing the stack,
+// the source code around each frame, and the request. All other errors are
+// passed to fallback. If fallback is nil, wherr.HTMLHandler is used.
+//
+// The panic page exposes source code and request headers, so only use this
+// during development:
+//
+//   handler := whfatal.CatchPanics(routes)
+//   if *dev {
+//     handler = wherr.HandleWith(whfatal.DevPanicPages(whjson.ErrHandler),
+//       handler)
+//   }
+//
+func DevPanicPages(fallback wherr.Handler) wherr.Handler {
+	if fallback == nil {
+		fallback = wherr.HTMLHandler
+	}
+	return wherr.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request, err error) {
+			stack := PanicStack(err)
+			if stack == "" {
+				fallback.HandleError(w, r, err)
+				return
+			}
+			var out bytes.Buffer
+			terr := panicPageTmpl.Execute(&out, panicPage{
+				Error:   err.Error(),
+				Frames:  parseStack(stack),
+				Request: r,
+				Headers: sortedHeaders(r.Header)})
+			if terr != nil {
+				log.Printf("failed rendering panic page: %v", terr)
+				fallback.HandleError(w, r, err)
+				return
+			}
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			w.Header().Set("Content-Length", fmt.Sprint(out.Len()))
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write(out.Bytes())
+		})
+}
+
+type panicPage struct {
+	Error   string
+	Frames  []stackFrame
+	Request *http.Request
+	Headers []header
+}
+
+type header struct {
+	Name, Value string
+}
+
+type stackFrame struct {
+	Func   string
+	File   string
+	Line   int
+	Source []sourceLine
+}
+
+type sourceLine struct {
+	Number  int
+	Text    string
+	Current bool
+}
+
+func sortedHeaders(h http.Header) (rv []header) {
+	for name, vals := range h {
+		for _, val := range vals {
+			rv = append(rv, header{Name: name, Value: val})
+		}
+	}
+	sort.Slice(rv, func(i, j int) bool { return rv[i].Name < rv[j].Name })
+	return rv
+}
+
+// parseStack understands the output of runtime/debug.Stack, which is a
+// goroutine header followed by pairs of lines: the function call, then a
+// tab-indented "file:line +offset" location.
+func parseStack(stack string) (frames []stackFrame) {
+	lines := strings.Split(strings.TrimSpace(stack), "\n")
+	sources := map[string][]string{}
+	for i := 1; i+1 < len(lines); i += 2 {
+		frame := stackFrame{Func: lines[i]}
+		location := strings.TrimSpace(lines[i+1])
+		if idx := strings.LastIndex(location, " +"); idx >= 0 {
+			location = location[:idx]
+		}
+		if idx := strings.LastIndex(location, ":"); idx >= 0 {
+			frame.File = location[:idx]
+			frame.Line, _ = strconv.Atoi(location[idx+1:])
+		}
+		if frame.File != "" {
+			source, ok := sources[frame.File]
+			if !ok {
+				source = readSource(frame.File)
+				sources[frame.File] = source
+			}
+			first, last := frame.Line-sourceContext, frame.Line+sourceContext
+			for n := first; n <= last; n++ {
+				if n < 1 || n > len(source) {
+					continue
+				}
+				frame.Source = append(frame.Source, sourceLine{
+					Number: n, Text: source[n-1], Current: n == frame.Line})
+			}
+		}
+		frames = append(frames, frame)
+	}
+	return frames
+}
+
+func readSource(path string) (lines []string) {
+	fh, err := os.Open(path)
+	if err != nil {
+		return nil
+	}
+	defer fh.Close()
+	scanner := bufio.NewScanner(fh)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	return lines
+}
+
+var panicPageTmpl = template.Must(template.New("").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<title>Panic: {{ .Error }}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+pre { background: #f4f4f4; padding: 0.5em; overflow-x: auto; }
+.current { background: #ffd7d7; font-weight: bold; }
+.func { font-family: monospace; font-weight: bold; margin-top: 1.5em; }
+td { font-family: monospace; vertical-align: top; padding-right: 1em; }
+</style>
+</head>
+<body>
+<h1>Panic</h1>
+<pre>{{ .Error }}</pre>
+
+<h2>Request</h2>
+<table>
+<tr><td>Method</td><td>{{ .Request.Method }}</td></tr>
+<tr><td>URL</td><td>{{ .Request.RequestURI }}</td></tr>
+<tr><td>Protocol</td><td>{{ .Request.Proto }}</td></tr>
+<tr><td>Host</td><td>{{ .Request.Host }}</td></tr>
+<tr><td>Remote address</td><td>{{ .Request.RemoteAddr }}</td></tr>
+{{- range .Headers }}
+<tr><td>{{ .Name }}</td><td>{{ .Value }}</td></tr>
+{{- end }}
+</table>
+
+<h2>Stack</h2>
+{{- range .Frames }}
+<div class="func">{{ .Func }}</div>
+<div>{{ .File }}:{{ .Line }}</div>
+{{- if .Source }}
+<pre>{{ range .Source }}<span{{ if .Current }} class="current"{{ end }}>{{ printf "%5d" .Number }}  {{ .Text }}</span>
+{{ end }}</pre>
+{{- end }}
+{{- end }}
+</body>
+</html>
+`))
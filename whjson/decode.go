@@ -0,0 +1,226 @@
+// Copyright (C) 2017 JT Olds
+// See LICENSE for copying information
+
+package whjson
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"strings"
+
+	"gopkg.in/webhelp.v1/wherr"
+)
+
+var (
+	// DefaultDecoder is the Decoder used by Decode and MustDecode.
+	DefaultDecoder = Decoder{
+		MaxBodySize:          1 << 20,
+		DisallowTrailingData: true}
+)
+
+// Decoder decodes JSON request bodies. All errors it returns are wherr
+// errors suitable for wherr.Handle.
+type Decoder struct {
+	// MaxBodySize is the largest request body, in bytes, that will be read.
+	// Larger bodies result in a wherr.RequestEntityTooLarge error. A value of
+	// zero or less means there is no limit.
+	MaxBodySize int64
+
+	// AnyContentType disables the Content-Type check. Otherwise, bodies that
+	// aren't application/json (or some other "+json" media type) result in a
+	// wherr.UnsupportedMediaType error.
+	AnyContentType bool
+
+	// DisallowUnknownFields causes object keys that don't match a field in the
+	// destination struct to be reported as errors. encoding/json doesn't say
+	// where the key was, so the field error only names the key itself, like
+	// "nmae", even when it's nested.
+	DisallowUnknownFields bool
+
+	// DisallowTrailingData causes anything but whitespace after the first
+	// JSON value to be reported as an error.
+	DisallowTrailingData bool
+}
+
+// Decode decodes the JSON body of r into dst using DefaultDecoder.
+func Decode(r *http.Request, dst interface{}) error {
+	return DefaultDecoder.Decode(r, dst)
+}
+
+// MustDecode is like Decode but panics with the error if decoding fails.
+// Meant to be used with whfatal.Catch, which will hand the error to
+// wherr.Handle.
+func MustDecode(r *http.Request, dst interface{}) {
+	DefaultDecoder.MustDecode(r, dst)
+}
+
+// MustDecode is like Decode but panics with the error if decoding fails.
+// Meant to be used with whfatal.Catch, which will hand the error to
+// wherr.Handle.
+func (d Decoder) MustDecode(r *http.Request, dst interface{}) {
+	err := d.Decode(r, dst)
+	if err != nil {
+		if !wherr.HTTPError.Contains(err) {
+			err = wherr.InternalServerError.Wrap(err)
+		}
+		panic(err)
+	}
+}
+
+// Decode decodes the JSON body of r into dst. Malformed JSON and values of the
+// wrong type are reported as wherr.BadRequest errors. Type errors and unknown
+// fields carry wherr field errors (see wherr.FieldErrors) naming the
+// offending field, like "items.0.price" for type errors or just "nmae" for
+// unknown fields (see DisallowUnknownFields).
+func (d Decoder) Decode(r *http.Request, dst interface{}) error {
+	if !d.AnyContentType {
+		err := checkContentType(r.Header.Get("Content-Type"))
+		if err != nil {
+			return err
+		}
+	}
+	if r.Body == nil {
+		return wherr.BadRequest.New("empty request body")
+	}
+
+	dec := json.NewDecoder(d.limit(r.Body))
+	if d.DisallowUnknownFields {
+		dec.DisallowUnknownFields()
+	}
+
+	err := dec.Decode(dst)
+	if err != nil {
+		return decodeError(err, d.MaxBodySize)
+	}
+	if d.DisallowTrailingData {
+		_, err = dec.Token()
+		if err == nil {
+			return wherr.BadRequest.New("unexpected data after JSON value")
+		}
+		if err != io.EOF {
+			return decodeError(err, d.MaxBodySize)
+		}
+	}
+	return nil
+}
+
+func checkContentType(contentType string) error {
+	if contentType == "" {
+		return wherr.UnsupportedMediaType.New(
+			"missing Content-Type, expected application/json")
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return wherr.UnsupportedMediaType.New("invalid Content-Type %#v",
+			contentType)
+	}
+	if mediaType != "application/json" &&
+		!strings.HasSuffix(mediaType, "+json") {
+		return wherr.UnsupportedMediaType.New(
+			"unsupported Content-Type %#v, expected application/json",
+			mediaType)
+	}
+	return nil
+}
+
+func decodeError(err error, maxBodySize int64) error {
+	switch e := err.(type) {
+	case *json.SyntaxError:
+		return wherr.BadRequest.New("malformed JSON at offset %d: %v",
+			e.Offset, e)
+	case *json.UnmarshalTypeError:
+		field := e.Field
+		if field == "" {
+			field = "."
+		}
+		return wherr.NewValidationError(wherr.BadRequest, wherr.FieldError{
+			Field: field,
+			Code:  "type",
+			Message: fmt.Sprintf("expected %s, got %s",
+				jsonTypeName(e.Type.Kind().String()), e.Value)})
+	case *json.InvalidUnmarshalError:
+		return err
+	}
+	switch {
+	case err == errBodyTooLarge:
+		return wherr.RequestEntityTooLarge.New(
+			"request body larger than %d bytes", maxBodySize)
+	case err == io.EOF:
+		return wherr.BadRequest.New("empty request body")
+	case err == io.ErrUnexpectedEOF:
+		return wherr.BadRequest.New("malformed JSON: unexpected end of input")
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		// encoding/json only reports unknown fields with this message, which
+		// doesn't include the path to the key.
+		field := strings.Trim(
+			strings.TrimPrefix(err.Error(), "json: unknown field "), `"`)
+		return wherr.NewValidationError(wherr.BadRequest, wherr.FieldError{
+			Field:   field,
+			Code:    "unknown",
+			Message: "unknown field"})
+	}
+	return wherr.BadRequest.Wrap(err)
+}
+
+func jsonTypeName(kind string) string {
+	switch {
+	case strings.HasPrefix(kind, "int"), strings.HasPrefix(kind, "uint"),
+		strings.HasPrefix(kind, "float"):
+		return "number"
+	case kind == "slice", kind == "array":
+		return "array"
+	case kind == "map", kind == "struct":
+		return "object"
+	case kind == "bool":
+		return "boolean"
+	}
+	return kind
+}
+
+// limit returns body limited to MaxBodySize bytes, if there is a limit.
+func (d Decoder) limit(body io.Reader) io.Reader {
+	if d.MaxBodySize <= 0 {
+		return body
+	}
+	return &limitedReader{r: body, remaining: d.MaxBodySize}
+}
+
+// readAll reads all of body, subject to MaxBodySize, for handlers that need
+// the raw bytes. Errors are wherr errors like Decode returns.
+func (d Decoder) readAll(body io.Reader) ([]byte, error) {
+	data, err := ioutil.ReadAll(d.limit(body))
+	if err != nil {
+		return nil, decodeError(err, d.MaxBodySize)
+	}
+	return data, nil
+}
+
+var errBodyTooLarge = errors.New("request body too large")
+
+// limitedReader is like io.LimitedReader but returns errBodyTooLarge instead
+// of io.EOF once the limit is exceeded, so truncated bodies aren't mistaken
+// for complete ones.
+type limitedReader struct {
+	r         io.Reader
+	remaining int64
+}
+
+func (l *limitedReader) Read(p []byte) (n int, err error) {
+	if l.remaining < 0 {
+		return 0, errBodyTooLarge
+	}
+	if int64(len(p)) > l.remaining+1 {
+		p = p[:l.remaining+1]
+	}
+	n, err = l.r.Read(p)
+	l.remaining -= int64(n)
+	if l.remaining < 0 {
+		return n, errBodyTooLarge
+	}
+	return n, err
+}
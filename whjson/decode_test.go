@@ -0,0 +1,92 @@
+// Copyright (C) 2017 JT Olds
+// See LICENSE for copying information
+
+package whjson_test
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"gopkg.in/webhelp.v1/wherr"
+	"gopkg.in/webhelp.v1/whjson"
+)
+
+type order struct {
+	Name  string `json:"name"`
+	Items []struct {
+		Price int `json:"price"`
+	} `json:"items"`
+}
+
+func TestDecode(t *testing.T) {
+	decoder := whjson.Decoder{
+		MaxBodySize:           64,
+		DisallowUnknownFields: true,
+		DisallowTrailingData:  true}
+
+	for _, test := range []struct {
+		contentType, body string
+		code              int
+		field             string
+	}{
+		{"application/json", `{"name": "x", "items": [{"price": 3}]}`, 0, ""},
+		{"application/vnd.api+json; charset=utf-8", `{"name": "x"}`, 0, ""},
+		{"text/plain", `{"name": "x"}`, 415, ""},
+		{"", `{"name": "x"}`, 415, ""},
+		{"application/json", ``, 400, ""},
+		{"application/json", `{"name": `, 400, ""},
+		{"application/json", `{"name": "x"}}`, 400, ""},
+		{"application/json", `{"name": "x"} {}`, 400, ""},
+		{"application/json", `{"items": [{"price": "3"}]}`, 400, "price"},
+		{"application/json", `{"nmae": "x"}`, 400, "nmae"},
+		{"application/json", `{"name": "` + strings.Repeat("x", 64) + `"}`,
+			413, ""},
+	} {
+		r := httptest.NewRequest("POST", "/", strings.NewReader(test.body))
+		if test.contentType != "" {
+			r.Header.Set("Content-Type", test.contentType)
+		}
+		var dst order
+		err := decoder.Decode(r, &dst)
+		if test.code == 0 {
+			if err != nil {
+				t.Errorf("%q: unexpected error: %v", test.body, err)
+			}
+			continue
+		}
+		if code := wherr.StatusCode(err); code != test.code {
+			t.Errorf("%q: expected %d, got %d (%v)", test.body, test.code, code,
+				err)
+		}
+		if test.field != "" {
+			fields := wherr.FieldErrors(err)
+			if len(fields) != 1 ||
+				!strings.HasSuffix(fields[0].Field, test.field) {
+				t.Errorf("%q: unexpected field errors %v", test.body, fields)
+			}
+		}
+	}
+}
+
+func TestDecodeUnknownField(t *testing.T) {
+	// Decoder recognizes unknown fields by encoding/json's error message.
+	var dst order
+	dec := json.NewDecoder(strings.NewReader(`{"items": [{"prcie": 3}]}`))
+	dec.DisallowUnknownFields()
+	err := dec.Decode(&dst)
+	if err == nil || err.Error() != `json: unknown field "prcie"` {
+		t.Fatalf("unexpected encoding/json error: %v", err)
+	}
+
+	r := httptest.NewRequest("POST", "/",
+		strings.NewReader(`{"items": [{"prcie": 3}]}`))
+	r.Header.Set("Content-Type", "application/json")
+	err = whjson.Decoder{DisallowUnknownFields: true}.Decode(r, &dst)
+	fields := wherr.FieldErrors(err)
+	if len(fields) != 1 || fields[0].Field != "prcie" ||
+		fields[0].Code != "unknown" {
+		t.Fatalf("unexpected field errors %v", fields)
+	}
+}
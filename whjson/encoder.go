@@ -0,0 +1,198 @@
+// Copyright (C) 2017 JT Olds
+// See LICENSE for copying information
+
+package whjson
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+
+	"golang.org/x/net/context"
+	"gopkg.in/webhelp.v1"
+	"gopkg.in/webhelp.v1/whcompat"
+	"gopkg.in/webhelp.v1/wherr"
+	"gopkg.in/webhelp.v1/whparse"
+	"gopkg.in/webhelp.v1/whroute"
+)
+
+var (
+	// DefaultEncoder is the Encoder used when none was bound with EncodeWith.
+	// It wraps responses like `{"resp": <value>}` and errors like
+	// `{"err": "message"}`, indented with two spaces.
+	DefaultEncoder = &Encoder{
+		Envelope:    true,
+		ResponseKey: "resp",
+		ErrorKey:    "err",
+		Indent:      "  ",
+		EscapeHTML:  true}
+
+	encoderKey = webhelp.GenSym()
+)
+
+// Encoder controls how Render and ErrHandler write JSON.
+type Encoder struct {
+	// Envelope, if true, wraps successful responses in an object, like
+	// `{"resp": <value>}`. Otherwise the value is written bare. Errors are
+	// always written as an object.
+	Envelope bool
+
+	// ResponseKey is the envelope key for successful responses. Defaults to
+	// "resp".
+	ResponseKey string
+
+	// ErrorKey is the key the error message is written under. Defaults to
+	// "err".
+	ErrorKey string
+
+	// Indent is used to pretty-print output. If empty, output is compact.
+	Indent string
+
+	// PrettyParam, if set, names a query parameter (like "pretty") that
+	// turns on indented output for a single request, even if Indent is empty.
+	PrettyParam string
+
+	// EscapeHTML escapes <, >, and & in strings, like json.Marshal does.
+	EscapeHTML bool
+}
+
+// EncodeWith binds the given Encoder to the request contexts that pass
+// through the given http.Handler, so Render and ErrHandler use it instead of
+// DefaultEncoder.
+func EncodeWith(e *Encoder, h http.Handler) http.Handler {
+	return whroute.HandlerFunc(h,
+		func(w http.ResponseWriter, r *http.Request) {
+			ctx := context.WithValue(whcompat.Context(r), encoderKey, e)
+			h.ServeHTTP(w, whcompat.WithContext(r, ctx))
+		})
+}
+
+// EncoderFor returns the Encoder bound to r with EncodeWith, or
+// DefaultEncoder.
+func EncoderFor(r *http.Request) *Encoder {
+	if e, ok := whcompat.Context(r).Value(encoderKey).(*Encoder); ok {
+		return e
+	}
+	return DefaultEncoder
+}
+
+func (e *Encoder) responseKey() string {
+	if e.ResponseKey == "" {
+		return "resp"
+	}
+	return e.ResponseKey
+}
+
+func (e *Encoder) errorKey() string {
+	if e.ErrorKey == "" {
+		return "err"
+	}
+	return e.ErrorKey
+}
+
+// Keys returns the envelope key for successful responses and the key error
+// messages are written under, with defaults filled in.
+func (e *Encoder) Keys() (responseKey, errorKey string) {
+	return e.responseKey(), e.errorKey()
+}
+
+func (e *Encoder) indent(r *http.Request) string {
+	if e.Indent == "" && e.PrettyParam != "" &&
+		whparse.OptBool(r.URL.Query().Get(e.PrettyParam), false) {
+		return "  "
+	}
+	return e.Indent
+}
+
+// Marshal encodes value as JSON for r, applying the Encoder's formatting
+// options but not the envelope.
+func (e *Encoder) Marshal(r *http.Request, value interface{}) (
+	[]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(e.EscapeHTML)
+	enc.SetIndent("", e.indent(r))
+	err := enc.Encode(value)
+	if err != nil {
+		return nil, err
+	}
+	// json.Encoder always adds a trailing newline.
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
+
+// Wrap returns value wrapped in the Encoder's envelope, if enabled.
+func (e *Encoder) Wrap(value interface{}) interface{} {
+	if !e.Envelope {
+		return value
+	}
+	return map[string]interface{}{e.responseKey(): value}
+}
+
+// Render is like the package-level Render, but uses this Encoder.
+func (e *Encoder) Render(w http.ResponseWriter, r *http.Request,
+	value interface{}) {
+	e.render(w, r, value, nil)
+}
+
+// render renders value, adding the extra fields to the envelope if there is
+// one.
+func (e *Encoder) render(w http.ResponseWriter, r *http.Request,
+	value interface{}, extra map[string]interface{}) {
+	err := checkResponse(r, value)
+	if err != nil {
+		handleError(w, r, err)
+		return
+	}
+	wrapped := e.Wrap(value)
+	if envelope, ok := wrapped.(map[string]interface{}); ok {
+		for key, val := range extra {
+			envelope[key] = val
+		}
+	}
+	data, err := e.Marshal(r, wrapped)
+	if err != nil {
+		handleError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Length", fmt.Sprint(len(data)))
+	w.Write(data)
+}
+
+// HandleError implements wherr.Handler, like ErrHandler, but uses this
+// Encoder.
+func (e *Encoder) HandleError(w http.ResponseWriter, r *http.Request,
+	handledErr error) {
+	if !wherr.HasBody(handledErr) {
+		log.Printf("client closed request: %v", handledErr)
+		w.WriteHeader(wherr.StatusCode(handledErr))
+		return
+	}
+	log.Printf("error: %v", handledErr)
+	data, err := e.Marshal(r, e.ErrorValue(r, handledErr))
+	if err != nil {
+		log.Printf("failed serializing error: %v", handledErr)
+		data = []byte(fmt.Sprintf(`{%q: "Internal Server Error"}`,
+			e.errorKey()))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Length", fmt.Sprint(len(data)))
+	w.WriteHeader(wherr.StatusCode(handledErr))
+	w.Write(data)
+}
+
+// ErrorValue returns the object HandleError writes for err, like
+// `{"err": "message", "fields": {...}}`.
+func (e *Encoder) ErrorValue(r *http.Request,
+	err error) map[string]interface{} {
+	body := map[string]interface{}{e.errorKey(): wherr.Message(r, err)}
+	if fields := wherr.LocalizedFieldMap(r, err); fields != nil {
+		body["fields"] = fields
+	}
+	return body
+}
+
+var _ wherr.Handler = (*Encoder)(nil)
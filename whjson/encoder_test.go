@@ -0,0 +1,42 @@
+// Copyright (C) 2017 JT Olds
+// See LICENSE for copying information
+
+package whjson_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"gopkg.in/webhelp.v1/wherr"
+	"gopkg.in/webhelp.v1/whjson"
+)
+
+func TestEncoder(t *testing.T) {
+	encoder := &whjson.Encoder{
+		ErrorKey:    "error",
+		PrettyParam: "pretty"}
+	handler := whjson.EncodeWith(encoder, http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/err" {
+				whjson.ErrHandler.HandleError(w, r, wherr.NotFound.New("nope"))
+				return
+			}
+			whjson.Render(w, r, map[string]string{"a": "<b>"})
+		}))
+
+	for _, test := range []struct {
+		url, body string
+	}{
+		{"/", `{"a":"<b>"}`},
+		{"/?pretty=1", "{\n  \"a\": \"<b>\"\n}"},
+		{"/err", `{"error":"nope"}`},
+	} {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest("GET", test.url, nil))
+		if w.Body.String() != test.body {
+			t.Errorf("%s: expected %q, got %q", test.url, test.body,
+				w.Body.String())
+		}
+	}
+}
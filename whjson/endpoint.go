@@ -0,0 +1,122 @@
+// Copyright (C) 2017 JT Olds
+// See LICENSE for copying information
+
+package whjson
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+
+	"golang.org/x/net/context"
+	"gopkg.in/webhelp.v1/whcompat"
+	"gopkg.in/webhelp.v1/whparse"
+	"gopkg.in/webhelp.v1/whroute"
+)
+
+var (
+	contextType = reflect.TypeOf((*context.Context)(nil)).Elem()
+	errorType   = reflect.TypeOf((*error)(nil)).Elem()
+)
+
+type endpoint struct {
+	fn       reflect.Value
+	reqType  reflect.Type
+	respType reflect.Type
+}
+
+// Endpoint turns a function of the form
+//
+//   func(ctx context.Context, req Req) (Resp, error)
+//
+// into an http.Handler, where Req is a struct (or a pointer to one) and Resp
+// is any type that can be marshaled to JSON. Endpoint panics if fn doesn't
+// have that form.
+//
+// For POST, PUT, and PATCH requests, req is first filled in from the JSON
+// request body with Decode, unless there is no body and no Content-Type.
+// Then, for all requests, fields with whparse.Bind struct tags are filled in
+// from path arguments created with whmux.NewNamedStringArg or
+// whmux.NewNamedIntArg, the query string, form values, and headers:
+//
+//   type GetUserReq struct {
+//     ID      int64 `path:"id"`
+//     Verbose bool  `query:"verbose"`
+//   }
+//
+// The result is written with Render, and errors are handled by the
+// registered wherr.Handler, falling back to ErrHandler like Render does.
+// The request and response type names are listed as "Request" and
+// "Response" whroute annotations.
+func Endpoint(fn interface{}) http.Handler {
+	val := reflect.ValueOf(fn)
+	typ := val.Type()
+	if typ.Kind() != reflect.Func || typ.NumIn() != 2 || typ.NumOut() != 2 ||
+		typ.In(0) != contextType || typ.Out(1) != errorType {
+		panic(fmt.Sprintf("whjson: Endpoint needs a func(context.Context, "+
+			"Req) (Resp, error), not %v", typ))
+	}
+	reqType := typ.In(1)
+	structType := reqType
+	if structType.Kind() == reflect.Ptr {
+		structType = structType.Elem()
+	}
+	if structType.Kind() != reflect.Struct {
+		panic(fmt.Sprintf("whjson: Endpoint request type %v is not a struct",
+			reqType))
+	}
+	return endpoint{fn: val, reqType: reqType, respType: typ.Out(0)}
+}
+
+func (e endpoint) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := whcompat.Context(r)
+	req := e.newRequest()
+
+	var err error
+	if (r.Method == "POST" || r.Method == "PUT" || r.Method == "PATCH") &&
+		!emptyBody(r) {
+		err = Decode(r, req.Interface())
+	}
+	if err == nil {
+		err = whparse.Bind(r, req.Interface())
+	}
+	if err != nil {
+		handleError(w, r, err)
+		return
+	}
+
+	if e.reqType.Kind() != reflect.Ptr {
+		req = req.Elem()
+	}
+	out := e.fn.Call([]reflect.Value{reflect.ValueOf(ctx), req})
+	if errVal := out[1].Interface(); errVal != nil {
+		handleError(w, r, errVal.(error))
+		return
+	}
+	Render(w, r, out[0].Interface())
+}
+
+// emptyBody returns true if r has no body and no Content-Type, so there's
+// nothing to decode and all fields must come from Bind.
+func emptyBody(r *http.Request) bool {
+	return r.ContentLength == 0 && r.Header.Get("Content-Type") == ""
+}
+
+// newRequest returns a pointer to a new request struct.
+func (e endpoint) newRequest() reflect.Value {
+	if e.reqType.Kind() == reflect.Ptr {
+		return reflect.New(e.reqType.Elem())
+	}
+	return reflect.New(e.reqType)
+}
+
+// Routes implements whroute.Lister
+func (e endpoint) Routes(
+	cb func(method, path string, annotations map[string]string)) {
+	cb(whroute.AllMethods, whroute.AllPaths, map[string]string{
+		"Request":  e.reqType.String(),
+		"Response": e.respType.String()})
+}
+
+var _ http.Handler = endpoint{}
+var _ whroute.Lister = endpoint{}
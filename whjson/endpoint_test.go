@@ -0,0 +1,81 @@
+// Copyright (C) 2017 JT Olds
+// See LICENSE for copying information
+
+package whjson_test
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/context"
+	"gopkg.in/webhelp.v1/wherr"
+	"gopkg.in/webhelp.v1/whjson"
+	"gopkg.in/webhelp.v1/whmux"
+	"gopkg.in/webhelp.v1/whroute"
+)
+
+type getUserReq struct {
+	ID      int64 `path:"id"`
+	Verbose bool  `query:"verbose"`
+}
+
+type user struct {
+	ID   int64  `json:"id"`
+	Name string `json:"name"`
+}
+
+func TestEndpoint(t *testing.T) {
+	userID := whmux.NewNamedIntArg("id")
+	getUser := whjson.Endpoint(
+		func(ctx context.Context, req getUserReq) (*user, error) {
+			if !req.Verbose {
+				return nil, wherr.BadRequest.New("not verbose")
+			}
+			return &user{ID: req.ID, Name: "jt"}, nil
+		})
+	handler := userID.Shift(whmux.Method{
+		"GET":  getUser,
+		"POST": getUser,
+		"PUT": whjson.Endpoint(
+			func(ctx context.Context, req *user) (*user, error) {
+				return req, nil
+			}),
+	})
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/12?verbose=yes", nil))
+	if w.Code != 200 || !strings.Contains(w.Body.String(), `"id": 12`) {
+		t.Fatalf("unexpected response: %d %s", w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/12?verbose=maybe", nil))
+	if w.Code != 400 || !strings.Contains(w.Body.String(), `"verbose"`) {
+		t.Fatalf("unexpected response: %d %s", w.Code, w.Body.String())
+	}
+
+	// a POST without a body is bound from the path and query alone.
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("POST", "/7?verbose=yes", nil))
+	if w.Code != 200 || !strings.Contains(w.Body.String(), `"id": 7`) {
+		t.Fatalf("unexpected response: %d %s", w.Code, w.Body.String())
+	}
+
+	r := httptest.NewRequest("PUT", "/7",
+		bytes.NewBufferString(`{"name": "bob"}`))
+	r.Header.Set("Content-Type", "application/json")
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	if w.Code != 200 || !strings.Contains(w.Body.String(), `"name": "bob"`) {
+		t.Fatalf("unexpected response: %d %s", w.Code, w.Body.String())
+	}
+
+	var out bytes.Buffer
+	whroute.PrintRoutes(&out, handler)
+	if !strings.Contains(out.String(), "Request: whjson_test.getUserReq") ||
+		!strings.Contains(out.String(), "Response: *whjson_test.user") {
+		t.Fatalf("unexpected routes: %s", out.String())
+	}
+}
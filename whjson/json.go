@@ -6,12 +6,8 @@
 package whjson // import "gopkg.in/webhelp.v1/whjson"
 
 import (
-	"encoding/json"
-	"fmt"
-	"log"
 	"net/http"
 
-	"github.com/spacemonkeygo/errors/errhttp"
 	"gopkg.in/webhelp.v1/whcompat"
 	"gopkg.in/webhelp.v1/wherr"
 )
@@ -19,43 +15,36 @@ import (
 var (
 	// ErrHandler provides a good wherr.Handler. It will return a JSON object
 	// like `{"err": "message"}` where message is filled in with
-	// errhttp.GetErrorBody. The status code is set with errhttp.GetStatusCode.
+	// wherr.Message, so it is localized if a wherr.Catalog is registered. The
+	// status code is set with wherr.StatusCode.
+	// If the error carries field errors (see wherr.NewValidationError), they
+	// are included like `{"err": "message", "fields": {"name": [...]}}`.
+	// The output is formatted by the Encoder bound with EncodeWith, or
+	// DefaultEncoder.
 	ErrHandler = wherr.HandlerFunc(errHandler)
 )
 
-func errHandler(w http.ResponseWriter, r *http.Request, handledErr error) {
-	log.Printf("error: %v", handledErr)
-	data, err := json.MarshalIndent(map[string]string{
-		"err": errhttp.GetErrorBody(handledErr)}, "", "  ")
-	if err != nil {
-		log.Printf("failed serializing error: %v", handledErr)
-		data = []byte(`{"err": "Internal Server Error"}`)
+func errHandler(w http.ResponseWriter, r *http.Request, err error) {
+	EncoderFor(r).HandleError(w, r, err)
+}
+
+// handleError is like wherr.Handle, but falls back to ErrHandler instead of
+// wherr's default if no error handler was registered.
+func handleError(w http.ResponseWriter, r *http.Request, err error) {
+	wherr.AbortIfStarted(w, err)
+	if handler := wherr.HandlingWith(whcompat.Context(r)); handler != nil {
+		handler.HandleError(w, r, err)
+		return
 	}
-	w.Header().Set("Content-Type", "application/json")
-	w.Header().Set("Content-Length", fmt.Sprint(len(data)))
-	w.WriteHeader(errhttp.GetStatusCode(handledErr,
-		http.StatusInternalServerError))
-	w.Write(data)
+	errHandler(w, r, err)
 }
 
 // Render will render JSON `value` like `{"resp": <value>}`, falling back to
 // ErrHandler if no error handler was registered and an error is
 // encountered. This is good for making sure your API is always returning
 // usefully namespaced JSON objects that are clearly differentiated from error
-// responses.
+// responses. The envelope and formatting are controlled by the Encoder bound
+// with EncodeWith, or DefaultEncoder.
 func Render(w http.ResponseWriter, r *http.Request, value interface{}) {
-	data, err := json.MarshalIndent(
-		map[string]interface{}{"resp": value}, "", "  ")
-	if err != nil {
-		if handler := wherr.HandlingWith(whcompat.Context(r)); handler != nil {
-			handler.HandleError(w, r, err)
-			return
-		}
-		errHandler(w, r, err)
-		return
-	}
-
-	w.Header().Set("Content-Type", "application/json")
-	w.Header().Set("Content-Length", fmt.Sprint(len(data)))
-	w.Write(data)
+	EncoderFor(r).Render(w, r, value)
 }
@@ -0,0 +1,45 @@
+// Copyright (C) 2017 JT Olds
+// See LICENSE for copying information
+
+package whjson
+
+import (
+	"net/http"
+
+	"gopkg.in/webhelp.v1/whparse"
+)
+
+// PageLinks are the URLs of the pages before and after a page of results,
+// such as those whparse.Paginator generates. Empty URLs are left out.
+type PageLinks struct {
+	Next, Prev string
+}
+
+// RenderPage is like Render, but also links to the neighboring pages. The
+// links are sent in an RFC 8288 Link header, like
+// `Link: </items?offset=40>; rel="next", </items?offset=0>; rel="prev"`, and,
+// if the Encoder uses an envelope, as "next" and "prev" fields alongside the
+// response, like `{"resp": [...], "next": "/items?offset=40"}`.
+func RenderPage(w http.ResponseWriter, r *http.Request, items interface{},
+	links PageLinks) {
+	EncoderFor(r).RenderPage(w, r, items, links)
+}
+
+// RenderPage is like the package-level RenderPage, but uses this Encoder.
+func (e *Encoder) RenderPage(w http.ResponseWriter, r *http.Request,
+	items interface{}, links PageLinks) {
+	var header []whparse.Link
+	extra := map[string]interface{}{}
+	for _, link := range []struct{ rel, url string }{
+		{"next", links.Next}, {"prev", links.Prev}} {
+		if link.url == "" {
+			continue
+		}
+		header = append(header, whparse.Link{URL: link.url, Rel: link.rel})
+		extra[link.rel] = link.url
+	}
+	if len(header) > 0 {
+		w.Header().Add("Link", whparse.FormatLinks(header...))
+	}
+	e.render(w, r, items, extra)
+}
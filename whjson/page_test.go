@@ -0,0 +1,80 @@
+// Copyright (C) 2017 JT Olds
+// See LICENSE for copying information
+
+package whjson_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"gopkg.in/webhelp.v1/wherr"
+	"gopkg.in/webhelp.v1/whjson"
+	"gopkg.in/webhelp.v1/whparse"
+)
+
+func TestRenderPage(t *testing.T) {
+	p := &whparse.Paginator{DefaultSize: 2, MaxSize: 10,
+		Secret: []byte("secret")}
+
+	r := httptest.NewRequest("GET", "/items?q=x&offset=4", nil)
+	page := p.MustParse(r)
+	if page.Size != 2 || page.Offset != 4 {
+		t.Fatalf("unexpected page: %#v", page)
+	}
+	w := httptest.NewRecorder()
+	whjson.RenderPage(w, r, []int{5, 6}, whjson.PageLinks{
+		Next: p.NextOffsetURL(r, page),
+		Prev: p.PrevOffsetURL(r, page)})
+	if link := w.Header().Get("Link"); link != `</items?offset=6&q=x>; `+
+		`rel="next", </items?offset=2&q=x>; rel="prev"` {
+		t.Fatalf("unexpected Link header: %s", link)
+	}
+	if !strings.Contains(w.Body.String(), `"next": "/items?offset=6\u0026q=x"`) {
+		t.Fatalf("unexpected body: %s", w.Body.String())
+	}
+
+	next := p.CursorURL(r, "id:6")
+	r = httptest.NewRequest("GET", next, nil)
+	if page = p.MustParse(r); page.Cursor != "id:6" || page.Offset != 0 {
+		t.Fatalf("unexpected page: %#v", page)
+	}
+
+	for _, query := range []string{
+		"limit=11", "limit=0", "offset=-1", "cursor=aWQ6Nw.forged",
+		"offset=2&" + strings.SplitN(next, "?", 2)[1]} {
+		_, err := p.Parse(httptest.NewRequest("GET", "/items?"+query, nil))
+		if wherr.StatusCode(err) != http.StatusBadRequest {
+			t.Fatalf("%s: expected bad request, got %v", query, err)
+		}
+	}
+}
+
+func TestCursorWithoutSecret(t *testing.T) {
+	p := &whparse.Paginator{}
+	defer func() {
+		if recover() == nil {
+			t.Fatal("expected panic")
+		}
+	}()
+	p.CursorURL(httptest.NewRequest("GET", "/items", nil), "id:6")
+}
+
+func TestPageDefaultSize(t *testing.T) {
+	r := httptest.NewRequest("GET", "/items", nil)
+	for _, test := range []struct {
+		p    *whparse.Paginator
+		size int
+	}{
+		{&whparse.Paginator{DefaultSize: 5, MaxSize: 50}, 5},
+		{&whparse.Paginator{MaxSize: 50}, 50},
+		{&whparse.Paginator{}, 20},
+	} {
+		page, err := test.p.Parse(r)
+		if err != nil || page.Size != test.size {
+			t.Fatalf("%#v: expected size %d, got %#v (%v)", test.p, test.size,
+				page, err)
+		}
+	}
+}
@@ -0,0 +1,491 @@
+// Copyright (C) 2017 JT Olds
+// See LICENSE for copying information
+
+package whjson
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/spacemonkeygo/errors"
+	"github.com/spacemonkeygo/errors/errhttp"
+	"gopkg.in/webhelp.v1/wherr"
+)
+
+const (
+	// JSONPatchType is the media type of RFC 6902 JSON Patch documents.
+	JSONPatchType = "application/json-patch+json"
+	// MergePatchType is the media type of RFC 7396 JSON Merge Patch
+	// documents.
+	MergePatchType = "application/merge-patch+json"
+)
+
+// Patch applies the patch in the body of r to dst, which must be a pointer
+// to a value that can be marshaled to and from JSON. dst is marshaled, the
+// patch is applied with PatchJSON, and the result is unmarshaled into a new
+// value that replaces *dst, so fields that aren't part of dst's JSON form
+// end up zeroed. dst is left alone if anything fails.
+func Patch(r *http.Request, dst interface{}) error {
+	v := reflect.ValueOf(dst)
+	if v.Kind() != reflect.Ptr || v.IsNil() {
+		return wherr.InternalServerError.New(
+			"whjson: Patch needs a non-nil pointer, not %T", dst)
+	}
+	doc, err := json.Marshal(dst)
+	if err != nil {
+		return wherr.InternalServerError.Wrap(err)
+	}
+	doc, err = PatchJSON(r, doc)
+	if err != nil {
+		return err
+	}
+	fresh := reflect.New(v.Elem().Type())
+	dec := json.NewDecoder(bytes.NewReader(doc))
+	dec.DisallowUnknownFields()
+	err = dec.Decode(fresh.Interface())
+	if err != nil {
+		return decodeError(err, 0)
+	}
+	v.Elem().Set(fresh.Elem())
+	return nil
+}
+
+// MustPatch is like Patch but panics with the error if patching fails.
+// Meant to be used with whfatal.Catch, which will hand the error to
+// wherr.Handle.
+func MustPatch(r *http.Request, dst interface{}) {
+	err := Patch(r, dst)
+	if err != nil {
+		if !wherr.HTTPError.Contains(err) {
+			err = wherr.InternalServerError.Wrap(err)
+		}
+		panic(err)
+	}
+}
+
+// PatchJSON applies the patch in the body of r to the JSON document doc and
+// returns the patched document. The patch format is picked by the request
+// Content-Type: JSONPatchType bodies are applied with ApplyJSONPatch, while
+// MergePatchType and plain application/json bodies are applied with
+// ApplyMergePatch. Other content types result in a
+// wherr.UnsupportedMediaType error. The body is limited to
+// DefaultDecoder.MaxBodySize bytes.
+func PatchJSON(r *http.Request, doc []byte) ([]byte, error) {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		mediaType = ""
+	}
+	var apply func(doc, patch []byte) ([]byte, error)
+	switch mediaType {
+	case JSONPatchType:
+		apply = ApplyJSONPatch
+	case MergePatchType, "application/json":
+		apply = ApplyMergePatch
+	default:
+		return nil, wherr.UnsupportedMediaType.New(
+			"unsupported Content-Type %#v, expected %s or %s",
+			r.Header.Get("Content-Type"), JSONPatchType, MergePatchType)
+	}
+	if r.Body == nil {
+		return nil, wherr.BadRequest.New("empty request body")
+	}
+	patch, err := DefaultDecoder.readAll(r.Body)
+	if err != nil {
+		return nil, err
+	}
+	return apply(doc, patch)
+}
+
+// ApplyMergePatch applies the RFC 7396 JSON Merge Patch document patch to
+// doc and returns the result. A malformed patch results in a
+// wherr.BadRequest error.
+func ApplyMergePatch(doc, patch []byte) ([]byte, error) {
+	target, err := unmarshalDoc(doc)
+	if err != nil {
+		return nil, wherr.InternalServerError.Wrap(err)
+	}
+	patchVal, err := unmarshalDoc(patch)
+	if err != nil {
+		return nil, decodeError(err, 0)
+	}
+	return json.Marshal(mergePatch(target, patchVal))
+}
+
+func mergePatch(target, patch interface{}) interface{} {
+	patchObj, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+	targetObj, ok := target.(map[string]interface{})
+	if !ok {
+		targetObj = map[string]interface{}{}
+	}
+	for key, val := range patchObj {
+		if val == nil {
+			delete(targetObj, key)
+		} else {
+			targetObj[key] = mergePatch(targetObj[key], val)
+		}
+	}
+	return targetObj
+}
+
+type patchOp struct {
+	Op    string          `json:"op"`
+	Path  *string         `json:"path"`
+	From  *string         `json:"from"`
+	Value json.RawMessage `json:"value"`
+}
+
+// ApplyJSONPatch applies the RFC 6902 JSON Patch document patch to doc and
+// returns the result. Operations are applied in order, and nothing is
+// returned unless they all succeed. A failed "test" operation, including one
+// whose location doesn't exist, results in a wherr.Conflict error. Malformed
+// patches, malformed JSON pointers, and other pointers to locations that
+// don't exist result in wherr.BadRequest errors. Errors keep their original
+// data, and their body names the failed operation.
+func ApplyJSONPatch(doc, patch []byte) ([]byte, error) {
+	target, err := unmarshalDoc(doc)
+	if err != nil {
+		return nil, wherr.InternalServerError.Wrap(err)
+	}
+	var ops []patchOp
+	err = json.Unmarshal(patch, &ops)
+	if err != nil {
+		return nil, decodeError(err, 0)
+	}
+	for i, op := range ops {
+		target, err = applyOp(target, op)
+		if err != nil {
+			return nil, errors.GetClass(err).Wrap(err, errhttp.SetErrorBody(
+				fmt.Sprintf("patch operation %d (%s): %s", i, op.Op,
+					errors.GetMessage(err))))
+		}
+	}
+	return json.Marshal(target)
+}
+
+func applyOp(doc interface{}, op patchOp) (interface{}, error) {
+	if op.Path == nil {
+		return nil, wherr.BadRequest.New("missing path")
+	}
+	path, err := parsePointer(*op.Path)
+	if err != nil {
+		return nil, err
+	}
+	var value interface{}
+	switch op.Op {
+	case "add", "replace", "test":
+		if len(op.Value) == 0 {
+			return nil, wherr.BadRequest.New("missing value")
+		}
+		value, err = unmarshalDoc(op.Value)
+		if err != nil {
+			return nil, wherr.BadRequest.Wrap(err)
+		}
+	case "move", "copy":
+		if op.From == nil {
+			return nil, wherr.BadRequest.New("missing from")
+		}
+		from, err := parsePointer(*op.From)
+		if err != nil {
+			return nil, err
+		}
+		value, err = getPointer(doc, from)
+		if err != nil {
+			return nil, err
+		}
+		if op.Op == "copy" {
+			value = deepCopy(value)
+			break
+		}
+		if len(path) > len(from) && isPrefix(from, path) {
+			return nil, wherr.BadRequest.New(
+				"can't move %#v into one of its children", *op.From)
+		}
+		doc, err = removePointer(doc, from)
+		if err != nil {
+			return nil, err
+		}
+	case "remove":
+	default:
+		return nil, wherr.BadRequest.New("unknown op %#v", op.Op)
+	}
+
+	switch op.Op {
+	case "add", "move", "copy":
+		return addPointer(doc, path, value)
+	case "remove":
+		return removePointer(doc, path)
+	case "replace":
+		if _, err := getPointer(doc, path); err != nil {
+			return nil, err
+		}
+		if len(path) == 0 {
+			return value, nil
+		}
+		return update(doc, path,
+			func(parent interface{}, key string) (interface{}, error) {
+				return setChild(parent, key, value)
+			})
+	default: // test
+		// a missing location fails the test like a different value would.
+		current, err := getPointer(doc, path)
+		if err != nil {
+			return nil, wherr.Conflict.New("test failed at %#v: %s", *op.Path,
+				errors.GetMessage(err))
+		}
+		if !jsonEqual(current, value) {
+			return nil, wherr.Conflict.New("test failed at %#v", *op.Path)
+		}
+		return doc, nil
+	}
+}
+
+func unmarshalDoc(data []byte) (interface{}, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var doc interface{}
+	err := dec.Decode(&doc)
+	return doc, err
+}
+
+// parsePointer splits an RFC 6901 JSON pointer into its unescaped reference
+// tokens.
+func parsePointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return nil, nil
+	}
+	if pointer[0] != '/' {
+		return nil, wherr.BadRequest.New(
+			"invalid JSON pointer %#v: must start with /", pointer)
+	}
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		for j := 0; j < len(token); j++ {
+			if token[j] == '~' && (j+1 >= len(token) ||
+				(token[j+1] != '0' && token[j+1] != '1')) {
+				return nil, wherr.BadRequest.New(
+					"invalid JSON pointer %#v: bad escape", pointer)
+			}
+		}
+		tokens[i] = strings.Replace(
+			strings.Replace(token, "~1", "/", -1), "~0", "~", -1)
+	}
+	return tokens, nil
+}
+
+func isPrefix(prefix, tokens []string) bool {
+	for i := range prefix {
+		if prefix[i] != tokens[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func arrayIndex(arr []interface{}, key string, allowEnd bool) (int, error) {
+	if allowEnd && key == "-" {
+		return len(arr), nil
+	}
+	// RFC 6901 indexes are "0" or digits without a leading zero, so no signs.
+	if key == "" || (key != "0" && key[0] == '0') {
+		return 0, wherr.BadRequest.New("invalid array index %#v", key)
+	}
+	for i := 0; i < len(key); i++ {
+		if key[i] < '0' || key[i] > '9' {
+			return 0, wherr.BadRequest.New("invalid array index %#v", key)
+		}
+	}
+	idx, err := strconv.Atoi(key)
+	if err != nil {
+		return 0, wherr.BadRequest.New("invalid array index %#v", key)
+	}
+	max := len(arr) - 1
+	if allowEnd {
+		max = len(arr)
+	}
+	if idx > max {
+		return 0, wherr.BadRequest.New("array index %d out of range", idx)
+	}
+	return idx, nil
+}
+
+func getChild(doc interface{}, key string) (interface{}, error) {
+	switch node := doc.(type) {
+	case map[string]interface{}:
+		child, ok := node[key]
+		if !ok {
+			return nil, wherr.BadRequest.New("no member %#v", key)
+		}
+		return child, nil
+	case []interface{}:
+		idx, err := arrayIndex(node, key, false)
+		if err != nil {
+			return nil, err
+		}
+		return node[idx], nil
+	}
+	return nil, wherr.BadRequest.New("can't look up %#v in a %s", key,
+		typeOf(doc))
+}
+
+func setChild(doc interface{}, key string, value interface{}) (
+	interface{}, error) {
+	switch node := doc.(type) {
+	case map[string]interface{}:
+		node[key] = value
+		return node, nil
+	case []interface{}:
+		idx, err := arrayIndex(node, key, false)
+		if err != nil {
+			return nil, err
+		}
+		node[idx] = value
+		return node, nil
+	}
+	return nil, wherr.BadRequest.New("can't set %#v in a %s", key,
+		typeOf(doc))
+}
+
+func getPointer(doc interface{}, tokens []string) (interface{}, error) {
+	for _, token := range tokens {
+		var err error
+		doc, err = getChild(doc, token)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return doc, nil
+}
+
+// update walks doc to the parent of the location tokens refers to, replaces
+// that parent with what fn returns, and returns the updated doc. Arrays may
+// be reallocated along the way, so callers must use the returned doc.
+func update(doc interface{}, tokens []string,
+	fn func(parent interface{}, key string) (interface{}, error)) (
+	interface{}, error) {
+	if len(tokens) == 1 {
+		return fn(doc, tokens[0])
+	}
+	child, err := getChild(doc, tokens[0])
+	if err != nil {
+		return nil, err
+	}
+	child, err = update(child, tokens[1:], fn)
+	if err != nil {
+		return nil, err
+	}
+	return setChild(doc, tokens[0], child)
+}
+
+func addPointer(doc interface{}, tokens []string, value interface{}) (
+	interface{}, error) {
+	if len(tokens) == 0 {
+		return value, nil
+	}
+	return update(doc, tokens,
+		func(parent interface{}, key string) (interface{}, error) {
+			arr, ok := parent.([]interface{})
+			if !ok {
+				if _, ok := parent.(map[string]interface{}); !ok {
+					return nil, wherr.BadRequest.New("can't add %#v to a %s",
+						key, typeOf(parent))
+				}
+				return setChild(parent, key, value)
+			}
+			idx, err := arrayIndex(arr, key, true)
+			if err != nil {
+				return nil, err
+			}
+			arr = append(arr, nil)
+			copy(arr[idx+1:], arr[idx:])
+			arr[idx] = value
+			return arr, nil
+		})
+}
+
+func removePointer(doc interface{}, tokens []string) (interface{}, error) {
+	if len(tokens) == 0 {
+		return nil, wherr.BadRequest.New("can't remove the whole document")
+	}
+	return update(doc, tokens,
+		func(parent interface{}, key string) (interface{}, error) {
+			if _, err := getChild(parent, key); err != nil {
+				return nil, err
+			}
+			if obj, ok := parent.(map[string]interface{}); ok {
+				delete(obj, key)
+				return obj, nil
+			}
+			arr := parent.([]interface{})
+			idx, _ := arrayIndex(arr, key, false)
+			return append(arr[:idx:idx], arr[idx+1:]...), nil
+		})
+}
+
+func deepCopy(doc interface{}) interface{} {
+	switch node := doc.(type) {
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(node))
+		for key, val := range node {
+			out[key] = deepCopy(val)
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(node))
+		for i, val := range node {
+			out[i] = deepCopy(val)
+		}
+		return out
+	}
+	return doc
+}
+
+// jsonEqual compares two documents decoded by unmarshalDoc, treating numbers
+// as equal if they have the same value regardless of how they were written.
+func jsonEqual(a, b interface{}) bool {
+	switch a := a.(type) {
+	case map[string]interface{}:
+		b, ok := b.(map[string]interface{})
+		if !ok || len(a) != len(b) {
+			return false
+		}
+		for key, val := range a {
+			other, ok := b[key]
+			if !ok || !jsonEqual(val, other) {
+				return false
+			}
+		}
+		return true
+	case []interface{}:
+		b, ok := b.([]interface{})
+		if !ok || len(a) != len(b) {
+			return false
+		}
+		for i := range a {
+			if !jsonEqual(a[i], b[i]) {
+				return false
+			}
+		}
+		return true
+	case json.Number:
+		b, ok := b.(json.Number)
+		if !ok {
+			return false
+		}
+		af, aerr := a.Float64()
+		bf, berr := b.Float64()
+		if aerr != nil || berr != nil {
+			return a == b
+		}
+		return af == bf
+	}
+	return reflect.DeepEqual(a, b)
+}
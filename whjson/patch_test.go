@@ -0,0 +1,123 @@
+// Copyright (C) 2017 JT Olds
+// See LICENSE for copying information
+
+package whjson_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"gopkg.in/webhelp.v1/wherr"
+	"gopkg.in/webhelp.v1/whjson"
+)
+
+func TestApplyJSONPatch(t *testing.T) {
+	doc := `{"a": {"b": [1, 2, 3]}, "c~d": "x", "e/f": 1.0}`
+	for _, test := range []struct {
+		patch    string
+		expected string
+		status   int
+	}{
+		{`[{"op": "add", "path": "/a/b/1", "value": 9}]`,
+			`{"a":{"b":[1,9,2,3]},"c~d":"x","e/f":1.0}`, 0},
+		{`[{"op": "add", "path": "/a/b/-", "value": 4}]`,
+			`{"a":{"b":[1,2,3,4]},"c~d":"x","e/f":1.0}`, 0},
+		{`[{"op": "remove", "path": "/a/b/0"}, {"op": "remove", "path": "/c~0d"}]`,
+			`{"a":{"b":[2,3]},"e/f":1.0}`, 0},
+		{`[{"op": "replace", "path": "/e~1f", "value": null}]`,
+			`{"a":{"b":[1,2,3]},"c~d":"x","e/f":null}`, 0},
+		{`[{"op": "move", "from": "/a/b", "path": "/b"}]`,
+			`{"a":{},"b":[1,2,3],"c~d":"x","e/f":1.0}`, 0},
+		{`[{"op": "copy", "from": "/a/b/2", "path": "/a/z"}]`,
+			`{"a":{"b":[1,2,3],"z":3},"c~d":"x","e/f":1.0}`, 0},
+		{`[{"op": "test", "path": "/e~1f", "value": 1},
+		   {"op": "test", "path": "/a", "value": {"b": [1, 2, 3]}}]`,
+			`{"a":{"b":[1,2,3]},"c~d":"x","e/f":1.0}`, 0},
+		{`[{"op": "test", "path": "/c~0d", "value": "y"}]`, "", 409},
+		{`[{"op": "test", "path": "/a/nope", "value": "y"}]`, "", 409},
+		{`[{"op": "test", "path": "/a/b/5", "value": "y"}]`, "", 409},
+		{`[{"op": "remove", "path": "/nope"}]`, "", 400},
+		{`[{"op": "add", "path": "/a/b/7", "value": 1}]`, "", 400},
+		{`[{"op": "add", "path": "/a/b/+1", "value": 1}]`, "", 400},
+		{`[{"op": "remove", "path": "/a/b/-0"}]`, "", 400},
+		{`[{"op": "remove", "path": "/a/b/01"}]`, "", 400},
+		{`[{"op": "add", "path": "a", "value": 1}]`, "", 400},
+		{`[{"op": "add", "path": "/a~2", "value": 1}]`, "", 400},
+		{`[{"op": "move", "from": "/a", "path": "/a/b/x"}]`, "", 400},
+		{`[{"op": "frob", "path": "/a"}]`, "", 400},
+		{`{"op": "add"}`, "", 400},
+	} {
+		out, err := whjson.ApplyJSONPatch([]byte(doc), []byte(test.patch))
+		if test.status != 0 {
+			if err == nil || wherr.StatusCode(err) != test.status {
+				t.Fatalf("%s: expected status %d, got %v", test.patch,
+					test.status, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", test.patch, err)
+		}
+		if string(out) != test.expected {
+			t.Fatalf("%s: expected %s, got %s", test.patch, test.expected, out)
+		}
+	}
+}
+
+func TestApplyMergePatch(t *testing.T) {
+	out, err := whjson.ApplyMergePatch(
+		[]byte(`{"a": "b", "c": {"d": "e", "f": "g"}, "h": [1]}`),
+		[]byte(`{"a": "z", "c": {"f": null}, "h": {"i": 1}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != `{"a":"z","c":{"d":"e"},"h":{"i":1}}` {
+		t.Fatalf("unexpected result: %s", out)
+	}
+}
+
+func TestPatch(t *testing.T) {
+	patch := func(contentType, body string, u *user) error {
+		r := httptest.NewRequest("PATCH", "/", strings.NewReader(body))
+		r.Header.Set("Content-Type", contentType)
+		return whjson.Patch(r, u)
+	}
+
+	u := user{ID: 1, Name: "jt"}
+	err := patch(whjson.MergePatchType, `{"name": "bob"}`, &u)
+	if err != nil || u != (user{ID: 1, Name: "bob"}) {
+		t.Fatalf("unexpected result: %v %v", u, err)
+	}
+	err = patch(whjson.JSONPatchType,
+		`[{"op": "replace", "path": "/id", "value": 2}]`, &u)
+	if err != nil || u != (user{ID: 2, Name: "bob"}) {
+		t.Fatalf("unexpected result: %v %v", u, err)
+	}
+	err = patch(whjson.JSONPatchType,
+		`[{"op": "replace", "path": "/id", "value": "two"}]`, &u)
+	if wherr.StatusCode(err) != http.StatusBadRequest || u.ID != 2 {
+		t.Fatalf("unexpected result: %v %v", u, err)
+	}
+	err = patch("text/plain", `{}`, &u)
+	if wherr.StatusCode(err) != http.StatusUnsupportedMediaType {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	err = patch(whjson.JSONPatchType,
+		`[{"op": "test", "path": "/id", "value": 2},
+		  {"op": "remove", "path": "/nope"}]`, &u)
+	if wherr.StatusCode(err) != http.StatusBadRequest ||
+		wherr.ErrorBody(err) != `patch operation 1 (remove): no member "nope"` {
+		t.Fatalf("unexpected error: %v (%q)", err, wherr.ErrorBody(err))
+	}
+
+	// a MaxBodySize of zero means no limit.
+	defer func(size int64) { whjson.DefaultDecoder.MaxBodySize = size }(
+		whjson.DefaultDecoder.MaxBodySize)
+	whjson.DefaultDecoder.MaxBodySize = 0
+	err = patch(whjson.MergePatchType, `{"name": "al"}`, &u)
+	if err != nil || u.Name != "al" {
+		t.Fatalf("unexpected result: %v %v", u, err)
+	}
+}
@@ -0,0 +1,316 @@
+// Copyright (C) 2017 JT Olds
+// See LICENSE for copying information
+
+package whjson
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"reflect"
+	"runtime/debug"
+	"sort"
+	"sync"
+
+	"golang.org/x/net/context"
+	"gopkg.in/webhelp.v1/whcompat"
+	"gopkg.in/webhelp.v1/wherr"
+	"gopkg.in/webhelp.v1/whroute"
+)
+
+// Standard JSON-RPC 2.0 error codes.
+const (
+	RPCParseError     = -32700
+	RPCInvalidRequest = -32600
+	RPCMethodNotFound = -32601
+	RPCInvalidParams  = -32602
+	RPCInternalError  = -32603
+	// RPCServerError is used for all other errors. Its error data contains
+	// the HTTP status code wherr.StatusCode picked.
+	RPCServerError = -32000
+)
+
+// RPCError is a JSON-RPC 2.0 error object. Methods may return an *RPCError
+// to control the error code directly. All other errors are converted by
+// their wherr status code: 400 and 422 become RPCInvalidParams, 500 becomes
+// RPCInternalError, and anything else becomes RPCServerError.
+type RPCError struct {
+	Code    int         `json:"code"`
+	Message string      `json:"message"`
+	Data    interface{} `json:"data,omitempty"`
+}
+
+func (e *RPCError) Error() string {
+	return fmt.Sprintf("json-rpc error %d: %s", e.Code, e.Message)
+}
+
+type rpcMethod struct {
+	fn         reflect.Value
+	paramsType reflect.Type
+	resultType reflect.Type
+}
+
+// RPC is an http.Handler that serves JSON-RPC 2.0 requests, including
+// batches and notifications, over POST. Create one with NewRPC.
+type RPC struct {
+	mtx     sync.RWMutex
+	methods map[string]rpcMethod
+}
+
+// NewRPC creates an RPC handler with no methods.
+func NewRPC() *RPC {
+	return &RPC{methods: map[string]rpcMethod{}}
+}
+
+// Register adds a method, which must be a function of one of the forms
+//
+//   func(ctx context.Context, params Params) (Result, error)
+//   func(ctx context.Context) (Result, error)
+//
+// Params are unmarshaled from the request's "params" member, so Params
+// should be a struct for by-name parameters or a slice for by-position
+// parameters. Register panics if fn doesn't have one of those forms. Register
+// returns the RPC handler so calls can be chained.
+func (s *RPC) Register(name string, fn interface{}) *RPC {
+	val := reflect.ValueOf(fn)
+	typ := val.Type()
+	if typ.Kind() != reflect.Func || typ.NumIn() < 1 || typ.NumIn() > 2 ||
+		typ.NumOut() != 2 || typ.In(0) != contextType ||
+		typ.Out(1) != errorType {
+		panic(fmt.Sprintf("whjson: RPC method %q needs a func(context.Context"+
+			"[, Params]) (Result, error), not %v", name, typ))
+	}
+	method := rpcMethod{fn: val, resultType: typ.Out(0)}
+	if typ.NumIn() == 2 {
+		method.paramsType = typ.In(1)
+	}
+	s.mtx.Lock()
+	s.methods[name] = method
+	s.mtx.Unlock()
+	return s
+}
+
+type rpcRequest struct {
+	JSONRPC string          `json:"jsonrpc"`
+	Method  *string         `json:"method"`
+	Params  json.RawMessage `json:"params"`
+
+	// ID is empty if the id member is missing, which makes the request a
+	// notification, and "null" if it's explicitly null, which doesn't.
+	ID json.RawMessage `json:"id"`
+}
+
+type rpcResponse struct {
+	JSONRPC string           `json:"jsonrpc"`
+	Result  interface{}      `json:"result,omitempty"`
+	Error   *RPCError        `json:"error,omitempty"`
+	ID      *json.RawMessage `json:"id"`
+}
+
+var nullID = json.RawMessage("null")
+
+// ServeHTTP implements http.Handler
+func (s *RPC) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		handleError(w, r,
+			wherr.MethodNotAllowed.New("bad method: %#v", r.Method))
+		return
+	}
+	data, err := DefaultDecoder.readAll(r.Body)
+	if err != nil {
+		handleError(w, r, err)
+		return
+	}
+
+	ctx := whcompat.Context(r)
+	data = bytes.TrimSpace(data)
+	var result interface{}
+	if len(data) > 0 && data[0] == '[' {
+		var batch []json.RawMessage
+		if err := json.Unmarshal(data, &batch); err != nil {
+			result = rpcErrorResponse(&nullID, RPCParseError, err.Error())
+		} else if len(batch) == 0 {
+			result = rpcErrorResponse(&nullID, RPCInvalidRequest,
+				"empty batch")
+		} else {
+			var responses []*rpcResponse
+			for _, call := range batch {
+				if resp := s.call(ctx, r, call); resp != nil {
+					responses = append(responses, resp)
+				}
+			}
+			if len(responses) > 0 {
+				result = responses
+			}
+		}
+	} else if resp := s.call(ctx, r, data); resp != nil {
+		result = resp
+	}
+
+	if result == nil {
+		// only notifications
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	out, err := EncoderFor(r).Marshal(r, result)
+	if err != nil {
+		handleError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Length", fmt.Sprint(len(out)))
+	w.Write(out)
+}
+
+func rpcErrorResponse(id *json.RawMessage, code int,
+	message string) *rpcResponse {
+	return &rpcResponse{
+		JSONRPC: "2.0",
+		Error:   &RPCError{Code: code, Message: message},
+		ID:      id}
+}
+
+// call runs a single request and returns its response, or nil if it was a
+// notification.
+func (s *RPC) call(ctx context.Context, r *http.Request,
+	data json.RawMessage) *rpcResponse {
+	var req rpcRequest
+	if err := json.Unmarshal(data, &req); err != nil {
+		if _, ok := err.(*json.SyntaxError); ok {
+			return rpcErrorResponse(&nullID, RPCParseError, err.Error())
+		}
+		return rpcErrorResponse(&nullID, RPCInvalidRequest, err.Error())
+	}
+	notification := len(req.ID) == 0
+	id := &nullID
+	if !notification {
+		if !validRPCID(req.ID) {
+			return rpcErrorResponse(&nullID, RPCInvalidRequest,
+				"id must be a string, number, or null")
+		}
+		id = &req.ID
+	}
+	if req.JSONRPC != "2.0" || req.Method == nil {
+		return rpcErrorResponse(id, RPCInvalidRequest,
+			`requests need "jsonrpc": "2.0" and a method`)
+	}
+
+	resp, err := s.invoke(ctx, *req.Method, req.Params)
+	if notification {
+		if err != nil {
+			log.Printf("json-rpc notification %q failed: %v", *req.Method, err)
+		}
+		return nil
+	}
+	if err != nil {
+		return &rpcResponse{JSONRPC: "2.0", Error: rpcError(r, err), ID: id}
+	}
+	return &rpcResponse{JSONRPC: "2.0", Result: resp, ID: id}
+}
+
+// validRPCID returns true if id is a JSON string, number, or null.
+func validRPCID(id json.RawMessage) bool {
+	switch c := id[0]; {
+	case c == '"', c == '-', c >= '0' && c <= '9':
+		return true
+	}
+	return string(id) == "null"
+}
+
+// invoke calls the named method. A panicking method only fails its own call,
+// with RPCInternalError, so the rest of a batch still runs.
+func (s *RPC) invoke(ctx context.Context, name string,
+	params json.RawMessage) (result interface{}, err error) {
+	s.mtx.RLock()
+	method, ok := s.methods[name]
+	s.mtx.RUnlock()
+	if !ok {
+		return nil, &RPCError{Code: RPCMethodNotFound,
+			Message: fmt.Sprintf("method %q not found", name)}
+	}
+
+	args := []reflect.Value{reflect.ValueOf(ctx)}
+	if method.paramsType != nil {
+		paramsVal := reflect.New(method.paramsType)
+		if len(params) > 0 {
+			err := json.Unmarshal(params, paramsVal.Interface())
+			if err != nil {
+				return nil, &RPCError{Code: RPCInvalidParams,
+					Message: fmt.Sprintf("invalid params: %v", err)}
+			}
+		}
+		args = append(args, paramsVal.Elem())
+	}
+
+	defer func() {
+		rec := recover()
+		if rec == nil {
+			return
+		}
+		if rec == http.ErrAbortHandler {
+			panic(rec)
+		}
+		log.Printf("json-rpc method %q panicked: %v\n%s", name, rec,
+			debug.Stack())
+		result, err = nil, &RPCError{Code: RPCInternalError,
+			Message: "internal error"}
+	}()
+	out := method.fn.Call(args)
+	if errVal := out[1].Interface(); errVal != nil {
+		return nil, errVal.(error)
+	}
+	result = out[0].Interface()
+	if result == nil {
+		// "result" is required on success, so make sure it's there as null
+		return json.RawMessage("null"), nil
+	}
+	return result, nil
+}
+
+func rpcError(r *http.Request, err error) *RPCError {
+	if rpcErr, ok := err.(*RPCError); ok {
+		return rpcErr
+	}
+	log.Printf("json-rpc error: %v", err)
+	status := wherr.StatusCode(err)
+	data := map[string]interface{}{"status": status}
+	if fields := wherr.LocalizedFieldMap(r, err); fields != nil {
+		data["fields"] = fields
+	}
+	code := RPCServerError
+	switch status {
+	case http.StatusBadRequest, http.StatusUnprocessableEntity:
+		code = RPCInvalidParams
+	case http.StatusInternalServerError:
+		code = RPCInternalError
+	}
+	return &RPCError{Code: code, Message: wherr.Message(r, err), Data: data}
+}
+
+// Routes implements whroute.Lister. Each registered method is listed as an
+// "RPC <name>" annotation describing its parameter and result types.
+func (s *RPC) Routes(
+	cb func(method, path string, annotations map[string]string)) {
+	s.mtx.RLock()
+	names := make([]string, 0, len(s.methods))
+	for name := range s.methods {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	annotations := make(map[string]string, len(names))
+	for _, name := range names {
+		method := s.methods[name]
+		params := "()"
+		if method.paramsType != nil {
+			params = method.paramsType.String()
+		}
+		annotations["RPC "+name] = params + " -> " + method.resultType.String()
+	}
+	s.mtx.RUnlock()
+	cb("POST", whroute.AllPaths, annotations)
+}
+
+var _ http.Handler = (*RPC)(nil)
+var _ whroute.Lister = (*RPC)(nil)
@@ -0,0 +1,137 @@
+// Copyright (C) 2017 JT Olds
+// See LICENSE for copying information
+
+package whjson_test
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/context"
+	"gopkg.in/webhelp.v1/wherr"
+	"gopkg.in/webhelp.v1/whjson"
+	"gopkg.in/webhelp.v1/whroute"
+)
+
+type addParams struct {
+	A int `json:"a"`
+	B int `json:"b"`
+}
+
+func TestRPC(t *testing.T) {
+	rpc := whjson.NewRPC().
+		Register("add", func(ctx context.Context, p addParams) (int, error) {
+			return p.A + p.B, nil
+		}).
+		Register("fail", func(ctx context.Context) (interface{}, error) {
+			var v wherr.Validation
+			v.Add("a", "required", "a is required")
+			return nil, v.Err()
+		}).
+		Register("boom", func(ctx context.Context) (interface{}, error) {
+			panic("boom")
+		})
+
+	call := func(body string) (int, string) {
+		w := httptest.NewRecorder()
+		rpc.ServeHTTP(w, httptest.NewRequest("POST", "/",
+			strings.NewReader(body)))
+		return w.Code, w.Body.String()
+	}
+
+	code, body := call(`{"jsonrpc": "2.0", "method": "add",
+		"params": {"a": 1, "b": 2}, "id": 1}`)
+	if code != 200 || !strings.Contains(body, `"result": 3`) ||
+		!strings.Contains(body, `"id": 1`) {
+		t.Fatalf("unexpected response: %d %s", code, body)
+	}
+
+	code, body = call(`[
+		{"jsonrpc": "2.0", "method": "add", "params": {"a": 1}, "id": "x"},
+		{"jsonrpc": "2.0", "method": "add", "params": {"a": 1}},
+		{"jsonrpc": "2.0", "method": "nope", "id": 2},
+		{"jsonrpc": "2.0", "method": "fail", "id": 3},
+		{"jsonrpc": "1.0", "method": "add", "id": 4}]`)
+	var responses []struct {
+		Result json.RawMessage  `json:"result"`
+		Error  *whjson.RPCError `json:"error"`
+		ID     interface{}      `json:"id"`
+	}
+	if err := json.Unmarshal([]byte(body), &responses); err != nil {
+		t.Fatalf("bad batch response %q: %v", body, err)
+	}
+	if code != 200 || len(responses) != 4 {
+		t.Fatalf("unexpected response: %d %s", code, body)
+	}
+	if string(responses[0].Result) != "1" || responses[0].ID != "x" {
+		t.Fatalf("unexpected response: %s", body)
+	}
+	for i, expected := range []int{whjson.RPCMethodNotFound,
+		whjson.RPCInvalidParams, whjson.RPCInvalidRequest} {
+		if responses[i+1].Error == nil ||
+			responses[i+1].Error.Code != expected {
+			t.Fatalf("response %d: expected code %d: %s", i+1, expected, body)
+		}
+	}
+	if !strings.Contains(body, `"required"`) {
+		t.Fatalf("expected field errors in data: %s", body)
+	}
+
+	code, body = call(`{"jsonrpc": "2.0", "method": "add"}`)
+	if code != 204 || body != "" {
+		t.Fatalf("unexpected notification response: %d %q", code, body)
+	}
+
+	code, body = call(`{"jsonrpc": "2.0", "method": "add", "id": null}`)
+	if code != 200 || !strings.Contains(body, `"result": 0`) ||
+		!strings.Contains(body, `"id": null`) {
+		t.Fatalf("unexpected null id response: %d %s", code, body)
+	}
+
+	for _, id := range []string{`{}`, `[1]`, `true`} {
+		code, body = call(`{"jsonrpc": "2.0", "method": "add", "id": ` +
+			id + `}`)
+		if code != 200 || !strings.Contains(body, "-32600") ||
+			!strings.Contains(body, `"id": null`) {
+			t.Fatalf("expected invalid request for id %s: %d %s", id, code,
+				body)
+		}
+	}
+
+	code, body = call(`{"jsonrpc": "2.0", "method"`)
+	if !strings.Contains(body, "-32700") {
+		t.Fatalf("expected parse error: %d %s", code, body)
+	}
+
+	code, body = call(`[
+		{"jsonrpc": "2.0", "method": "boom", "id": 1},
+		{"jsonrpc": "2.0", "method": "add", "params": {"a": 2}, "id": 2}]`)
+	if code != 200 || !strings.Contains(body, "-32603") ||
+		!strings.Contains(body, `"result": 2`) {
+		t.Fatalf("expected panic to fail only its call: %d %s", code, body)
+	}
+
+	// a MaxBodySize of zero means no limit.
+	defer func(size int64) { whjson.DefaultDecoder.MaxBodySize = size }(
+		whjson.DefaultDecoder.MaxBodySize)
+	whjson.DefaultDecoder.MaxBodySize = 0
+	code, body = call(`{"jsonrpc": "2.0", "method": "add", "id": 1}`)
+	if code != 200 || !strings.Contains(body, `"result": 0`) {
+		t.Fatalf("unexpected unlimited response: %d %s", code, body)
+	}
+
+	var annotations map[string]string
+	whroute.Routes(rpc, func(method, path string, a map[string]string) {
+		if method != "POST" {
+			t.Fatalf("unexpected method %q", method)
+		}
+		annotations = a
+	})
+	if annotations["RPC add"] != "whjson_test.addParams -> int" ||
+		annotations["RPC fail"] != "() -> interface {}" ||
+		annotations["RPC boom"] != "() -> interface {}" {
+		t.Fatalf("unexpected annotations: %v", annotations)
+	}
+}
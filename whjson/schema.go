@@ -0,0 +1,781 @@
+// Copyright (C) 2017 JT Olds
+// See LICENSE for copying information
+
+package whjson
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"math"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"golang.org/x/net/context"
+	"gopkg.in/webhelp.v1"
+	"gopkg.in/webhelp.v1/whcompat"
+	"gopkg.in/webhelp.v1/wherr"
+	"gopkg.in/webhelp.v1/whroute"
+)
+
+var (
+	responseSchemaKey = webhelp.GenSym()
+)
+
+// Schema is a parsed JSON Schema. The following keywords are supported:
+// type, enum, const, properties, required, additionalProperties,
+// minProperties, maxProperties, items, minItems, maxItems, uniqueItems,
+// minimum, maximum, exclusiveMinimum, exclusiveMaximum, multipleOf,
+// minLength, maxLength, pattern, format (date-time, date, email, uri, and
+// uuid), allOf, anyOf, oneOf, and not. Boolean schemas are supported too,
+// as is $ref to the whole document ("#") or to top-level definitions (like
+// "#/definitions/address" or "#/$defs/address"). Annotation keywords like
+// title, description, and examples are allowed, and any other keyword is
+// an error, so a schema never silently accepts more than it says.
+type Schema struct {
+	// ID and Title are taken from the "$id" (or "id") and "title" keywords.
+	ID, Title string
+
+	always, never bool
+
+	types         []string
+	enum          []interface{}
+	constant      *interface{}
+	properties    map[string]*Schema
+	required      []string
+	additional    *Schema
+	minProperties *int
+	maxProperties *int
+	items         *Schema
+	minItems      *int
+	maxItems      *int
+	uniqueItems   bool
+	minimum       *float64
+	maximum       *float64
+	exclMinimum   *float64
+	exclMaximum   *float64
+	multipleOf    *float64
+	minLength     *int
+	maxLength     *int
+	pattern       *regexp.Regexp
+	format        string
+	allOf         []*Schema
+	anyOf         []*Schema
+	oneOf         []*Schema
+	not           *Schema
+	ref           *Schema
+}
+
+type rawSchema struct {
+	ID                   string                     `json:"$id"`
+	OldID                string                     `json:"id"`
+	Title                string                     `json:"title"`
+	Type                 json.RawMessage            `json:"type"`
+	Enum                 []interface{}              `json:"enum"`
+	Const                *json.RawMessage           `json:"const"`
+	Properties           map[string]json.RawMessage `json:"properties"`
+	Required             []string                   `json:"required"`
+	AdditionalProperties json.RawMessage            `json:"additionalProperties"`
+	MinProperties        *int                       `json:"minProperties"`
+	MaxProperties        *int                       `json:"maxProperties"`
+	Items                json.RawMessage            `json:"items"`
+	MinItems             *int                       `json:"minItems"`
+	MaxItems             *int                       `json:"maxItems"`
+	UniqueItems          bool                       `json:"uniqueItems"`
+	Minimum              *float64                   `json:"minimum"`
+	Maximum              *float64                   `json:"maximum"`
+	ExclusiveMinimum     json.RawMessage            `json:"exclusiveMinimum"`
+	ExclusiveMaximum     json.RawMessage            `json:"exclusiveMaximum"`
+	MultipleOf           *float64                   `json:"multipleOf"`
+	MinLength            *int                       `json:"minLength"`
+	MaxLength            *int                       `json:"maxLength"`
+	Pattern              string                     `json:"pattern"`
+	Format               string                     `json:"format"`
+	AllOf                []json.RawMessage          `json:"allOf"`
+	AnyOf                []json.RawMessage          `json:"anyOf"`
+	OneOf                []json.RawMessage          `json:"oneOf"`
+	Not                  json.RawMessage            `json:"not"`
+	Ref                  string                     `json:"$ref"`
+	Definitions          map[string]json.RawMessage `json:"definitions"`
+	Defs                 map[string]json.RawMessage `json:"$defs"`
+}
+
+// schemaKeywords are the keywords ParseSchema implements or, for
+// annotations, can safely ignore.
+var schemaKeywords = map[string]bool{
+	"type": true, "enum": true, "const": true, "properties": true,
+	"required": true, "additionalProperties": true, "minProperties": true,
+	"maxProperties": true, "items": true, "minItems": true, "maxItems": true,
+	"uniqueItems": true, "minimum": true, "maximum": true,
+	"exclusiveMinimum": true, "exclusiveMaximum": true, "multipleOf": true,
+	"minLength": true, "maxLength": true, "pattern": true, "format": true,
+	"allOf": true, "anyOf": true, "oneOf": true, "not": true, "$ref": true,
+	"definitions": true, "$defs": true,
+
+	// annotations
+	"$schema": true, "$id": true, "id": true, "$comment": true,
+	"title": true, "description": true, "default": true, "examples": true,
+	"readOnly": true, "writeOnly": true, "deprecated": true,
+	"contentMediaType": true, "contentEncoding": true,
+}
+
+// schemaParser keeps track of the top-level document while parsing, for
+// resolving $ref.
+type schemaParser struct {
+	root        *Schema
+	definitions map[string]json.RawMessage
+	resolved    map[string]*Schema
+}
+
+// ParseSchema parses a JSON Schema document. Keywords it doesn't support,
+// and references it can't resolve, are errors.
+func ParseSchema(data []byte) (*Schema, error) {
+	p := &schemaParser{root: &Schema{}, resolved: map[string]*Schema{}}
+	var raw rawSchema
+	if json.Unmarshal(bytes.TrimSpace(data), &raw) == nil {
+		p.definitions = raw.Definitions
+		if p.definitions == nil {
+			p.definitions = raw.Defs
+		} else {
+			for name, def := range raw.Defs {
+				p.definitions[name] = def
+			}
+		}
+	}
+	s, err := p.parse(data, true)
+	if err != nil {
+		return nil, err
+	}
+	*p.root = *s
+	for name := range p.definitions {
+		// parse unreferenced definitions too, so they're checked.
+		_, err = p.resolve("#/definitions/" +
+			strings.NewReplacer("~", "~0", "/", "~1").Replace(name))
+		if err != nil {
+			return nil, err
+		}
+	}
+	return p.root, nil
+}
+
+// resolve returns the schema ref points to. It may not be filled in yet if
+// it's still being parsed, which is how recursive schemas work.
+func (p *schemaParser) resolve(ref string) (*Schema, error) {
+	if ref == "#" {
+		return p.root, nil
+	}
+	name := ""
+	for _, prefix := range []string{"#/definitions/", "#/$defs/"} {
+		if strings.HasPrefix(ref, prefix) {
+			name = strings.NewReplacer("~1", "/", "~0", "~").Replace(
+				ref[len(prefix):])
+		}
+	}
+	raw, ok := p.definitions[name]
+	if name == "" || !ok {
+		return nil, fmt.Errorf("unsupported or unresolvable $ref %q", ref)
+	}
+	if s, ok := p.resolved[name]; ok {
+		return s, nil
+	}
+	s := &Schema{}
+	p.resolved[name] = s
+	parsed, err := p.parse(raw, false)
+	if err != nil {
+		return nil, fmt.Errorf("definition %q: %v", name, err)
+	}
+	*s = *parsed
+	return s, nil
+}
+
+func (p *schemaParser) parse(data []byte, top bool) (*Schema, error) {
+	data = bytes.TrimSpace(data)
+	switch string(data) {
+	case "true":
+		return &Schema{always: true}, nil
+	case "false":
+		return &Schema{never: true}, nil
+	}
+
+	var keywords map[string]json.RawMessage
+	err := json.Unmarshal(data, &keywords)
+	if err != nil {
+		return nil, err
+	}
+	var unsupported []string
+	for keyword := range keywords {
+		if !schemaKeywords[keyword] {
+			unsupported = append(unsupported, keyword)
+		}
+	}
+	if len(unsupported) > 0 {
+		sort.Strings(unsupported)
+		return nil, fmt.Errorf("unsupported schema keywords: %s",
+			strings.Join(unsupported, ", "))
+	}
+	var raw rawSchema
+	err = json.Unmarshal(data, &raw)
+	if err != nil {
+		return nil, err
+	}
+	if !top && (raw.Definitions != nil || raw.Defs != nil) {
+		return nil, fmt.Errorf("definitions are only supported at the top " +
+			"level")
+	}
+	s := &Schema{
+		ID:            raw.ID,
+		Title:         raw.Title,
+		enum:          raw.Enum,
+		required:      raw.Required,
+		minProperties: raw.MinProperties,
+		maxProperties: raw.MaxProperties,
+		minItems:      raw.MinItems,
+		maxItems:      raw.MaxItems,
+		uniqueItems:   raw.UniqueItems,
+		minimum:       raw.Minimum,
+		maximum:       raw.Maximum,
+		multipleOf:    raw.MultipleOf,
+		minLength:     raw.MinLength,
+		maxLength:     raw.MaxLength,
+		format:        raw.Format}
+	if s.ID == "" {
+		s.ID = raw.OldID
+	}
+
+	if len(raw.Type) > 0 {
+		var single string
+		if json.Unmarshal(raw.Type, &single) == nil {
+			s.types = []string{single}
+		} else if err := json.Unmarshal(raw.Type, &s.types); err != nil {
+			return nil, fmt.Errorf("invalid type: %v", err)
+		}
+	}
+	if raw.Const != nil {
+		var constant interface{}
+		err = json.Unmarshal(*raw.Const, &constant)
+		if err != nil {
+			return nil, err
+		}
+		s.constant = &constant
+	}
+	if raw.Pattern != "" {
+		s.pattern, err = regexp.Compile(raw.Pattern)
+		if err != nil {
+			return nil, err
+		}
+	}
+	s.exclMinimum, err = parseExclusive(raw.ExclusiveMinimum, s.minimum)
+	if err != nil {
+		return nil, err
+	}
+	s.exclMaximum, err = parseExclusive(raw.ExclusiveMaximum, s.maximum)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(raw.Properties) > 0 {
+		s.properties = make(map[string]*Schema, len(raw.Properties))
+		for name, prop := range raw.Properties {
+			s.properties[name], err = p.parse(prop, false)
+			if err != nil {
+				return nil, fmt.Errorf("property %q: %v", name, err)
+			}
+		}
+	}
+	for _, sub := range []struct {
+		raw json.RawMessage
+		dst **Schema
+	}{
+		{raw.AdditionalProperties, &s.additional},
+		{raw.Items, &s.items},
+		{raw.Not, &s.not}} {
+		if len(sub.raw) == 0 {
+			continue
+		}
+		*sub.dst, err = p.parse(sub.raw, false)
+		if err != nil {
+			return nil, err
+		}
+	}
+	for _, sub := range []struct {
+		raw []json.RawMessage
+		dst *[]*Schema
+	}{
+		{raw.AllOf, &s.allOf},
+		{raw.AnyOf, &s.anyOf},
+		{raw.OneOf, &s.oneOf}} {
+		for _, r := range sub.raw {
+			parsed, err := p.parse(r, false)
+			if err != nil {
+				return nil, err
+			}
+			*sub.dst = append(*sub.dst, parsed)
+		}
+	}
+	if raw.Ref != "" {
+		s.ref, err = p.resolve(raw.Ref)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// parseExclusive understands both the draft 4 boolean form (which modifies
+// minimum or maximum) and the later numeric form of exclusiveMinimum and
+// exclusiveMaximum.
+func parseExclusive(raw json.RawMessage, bound *float64) (*float64, error) {
+	if len(raw) == 0 {
+		return nil, nil
+	}
+	var flag bool
+	if json.Unmarshal(raw, &flag) == nil {
+		if flag {
+			return bound, nil
+		}
+		return nil, nil
+	}
+	var val float64
+	err := json.Unmarshal(raw, &val)
+	if err != nil {
+		return nil, err
+	}
+	return &val, nil
+}
+
+// MustParseSchema is like ParseSchema but panics on error. It's useful for
+// package-level schema variables.
+func MustParseSchema(schema string) *Schema {
+	s, err := ParseSchema([]byte(schema))
+	if err != nil {
+		panic(err)
+	}
+	return s
+}
+
+// Name returns the schema's title, or its ID, or "inline" if it has neither.
+func (s *Schema) Name() string {
+	switch {
+	case s.Title != "":
+		return s.Title
+	case s.ID != "":
+		return s.ID
+	}
+	return "inline"
+}
+
+// Validate checks a decoded JSON document (as produced by json.Unmarshal into
+// an interface{}) against the schema and returns all violations. Field paths
+// are dotted, like "items.0.price", with "." meaning the whole document.
+func (s *Schema) Validate(doc interface{}) []wherr.FieldError {
+	var v wherr.Validation
+	s.validate(&v, "", doc)
+	return v.Fields()
+}
+
+// ValidateJSON checks the JSON document data against the schema. Malformed
+// JSON results in a wherr.BadRequest error, and schema violations in a
+// wherr.UnprocessableEntity validation error (see wherr.FieldErrors).
+func (s *Schema) ValidateJSON(data []byte) error {
+	var doc interface{}
+	err := json.Unmarshal(data, &doc)
+	if err != nil {
+		return decodeError(err, 0)
+	}
+	var v wherr.Validation
+	s.validate(&v, "", doc)
+	return v.Err()
+}
+
+func joinPath(path string, elem string) string {
+	if path == "" {
+		return elem
+	}
+	return path + "." + elem
+}
+
+func displayPath(path string) string {
+	if path == "" {
+		return "."
+	}
+	return path
+}
+
+func typeOf(doc interface{}) string {
+	switch val := doc.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		if val == math.Trunc(val) {
+			return "integer"
+		}
+		return "number"
+	case json.Number:
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	}
+	return fmt.Sprintf("%T", doc)
+}
+
+func (s *Schema) valid(doc interface{}) bool {
+	var v wherr.Validation
+	s.validate(&v, "", doc)
+	return len(v.Fields()) == 0
+}
+
+func (s *Schema) validate(v *wherr.Validation, path string, doc interface{}) {
+	field := displayPath(path)
+	if s.always {
+		return
+	}
+	if s.never {
+		v.Add(field, "schema", "no value is allowed here")
+		return
+	}
+	if s.ref != nil {
+		s.ref.validate(v, path, doc)
+	}
+
+	if len(s.types) > 0 {
+		actual := typeOf(doc)
+		matched := false
+		for _, typ := range s.types {
+			if typ == actual || (typ == "number" && actual == "integer") {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			v.Addf(field, "type", "expected %s, got %s",
+				strings.Join(s.types, " or "), actual)
+			return
+		}
+	}
+	if s.enum != nil {
+		found := false
+		for _, option := range s.enum {
+			if reflect.DeepEqual(option, doc) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			v.Add(field, "enum", "value is not one of the allowed values")
+		}
+	}
+	if s.constant != nil && !reflect.DeepEqual(*s.constant, doc) {
+		v.Add(field, "const", "value is not the expected constant")
+	}
+
+	switch val := doc.(type) {
+	case map[string]interface{}:
+		s.validateObject(v, path, val)
+	case []interface{}:
+		s.validateArray(v, path, val)
+	case float64:
+		s.validateNumber(v, field, val)
+	case string:
+		s.validateString(v, field, val)
+	}
+
+	for _, sub := range s.allOf {
+		sub.validate(v, path, doc)
+	}
+	if len(s.anyOf) > 0 {
+		matched := false
+		for _, sub := range s.anyOf {
+			if sub.valid(doc) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			v.Add(field, "anyOf", "value matches none of the allowed schemas")
+		}
+	}
+	if len(s.oneOf) > 0 {
+		matches := 0
+		for _, sub := range s.oneOf {
+			if sub.valid(doc) {
+				matches++
+			}
+		}
+		if matches != 1 {
+			v.Addf(field, "oneOf",
+				"value must match exactly one schema, matched %d", matches)
+		}
+	}
+	if s.not != nil && s.not.valid(doc) {
+		v.Add(field, "not", "value matches a disallowed schema")
+	}
+}
+
+func (s *Schema) validateObject(v *wherr.Validation, path string,
+	obj map[string]interface{}) {
+	field := displayPath(path)
+	for _, name := range s.required {
+		if _, ok := obj[name]; !ok {
+			v.Add(joinPath(path, name), "required", "field is required")
+		}
+	}
+	if s.minProperties != nil && len(obj) < *s.minProperties {
+		v.Addf(field, "minProperties", "must have at least %d properties",
+			*s.minProperties)
+	}
+	if s.maxProperties != nil && len(obj) > *s.maxProperties {
+		v.Addf(field, "maxProperties", "must have at most %d properties",
+			*s.maxProperties)
+	}
+	for _, name := range sortedKeys(obj) {
+		if prop, ok := s.properties[name]; ok {
+			prop.validate(v, joinPath(path, name), obj[name])
+		} else if s.additional != nil {
+			if s.additional.never {
+				v.Add(joinPath(path, name), "additionalProperties",
+					"unknown field")
+				continue
+			}
+			s.additional.validate(v, joinPath(path, name), obj[name])
+		}
+	}
+}
+
+func (s *Schema) validateArray(v *wherr.Validation, path string,
+	arr []interface{}) {
+	field := displayPath(path)
+	if s.minItems != nil && len(arr) < *s.minItems {
+		v.Addf(field, "minItems", "must have at least %d items", *s.minItems)
+	}
+	if s.maxItems != nil && len(arr) > *s.maxItems {
+		v.Addf(field, "maxItems", "must have at most %d items", *s.maxItems)
+	}
+	if s.uniqueItems {
+	unique:
+		for i := range arr {
+			for j := 0; j < i; j++ {
+				if reflect.DeepEqual(arr[i], arr[j]) {
+					v.Add(field, "uniqueItems", "items must be unique")
+					break unique
+				}
+			}
+		}
+	}
+	if s.items != nil {
+		for i, item := range arr {
+			s.items.validate(v, joinPath(path, strconv.Itoa(i)), item)
+		}
+	}
+}
+
+func (s *Schema) validateNumber(v *wherr.Validation, field string,
+	num float64) {
+	if s.minimum != nil && num < *s.minimum {
+		v.Addf(field, "minimum", "must be at least %v", *s.minimum)
+	}
+	if s.maximum != nil && num > *s.maximum {
+		v.Addf(field, "maximum", "must be at most %v", *s.maximum)
+	}
+	if s.exclMinimum != nil && num <= *s.exclMinimum {
+		v.Addf(field, "exclusiveMinimum", "must be greater than %v",
+			*s.exclMinimum)
+	}
+	if s.exclMaximum != nil && num >= *s.exclMaximum {
+		v.Addf(field, "exclusiveMaximum", "must be less than %v",
+			*s.exclMaximum)
+	}
+	if s.multipleOf != nil && *s.multipleOf > 0 {
+		// decimal multiples like 0.1 aren't exact in binary, so allow for
+		// rounding error relative to the size of the quotient.
+		quotient := num / *s.multipleOf
+		if math.Abs(quotient-math.Floor(quotient+0.5)) >
+			multipleOfTolerance*math.Max(1, math.Abs(quotient)) {
+			v.Addf(field, "multipleOf", "must be a multiple of %v",
+				*s.multipleOf)
+		}
+	}
+}
+
+const multipleOfTolerance = 1e-9
+
+var uuidPattern = regexp.MustCompile(
+	`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-` +
+		`[0-9a-fA-F]{12}$`)
+
+func (s *Schema) validateString(v *wherr.Validation, field string,
+	str string) {
+	length := utf8.RuneCountInString(str)
+	if s.minLength != nil && length < *s.minLength {
+		v.Addf(field, "minLength", "must be at least %d characters",
+			*s.minLength)
+	}
+	if s.maxLength != nil && length > *s.maxLength {
+		v.Addf(field, "maxLength", "must be at most %d characters",
+			*s.maxLength)
+	}
+	if s.pattern != nil && !s.pattern.MatchString(str) {
+		v.Addf(field, "pattern", "must match %s", s.pattern)
+	}
+
+	var valid bool
+	switch s.format {
+	case "date-time":
+		_, err := time.Parse(time.RFC3339, str)
+		valid = err == nil
+	case "date":
+		_, err := time.Parse("2006-01-02", str)
+		valid = err == nil
+	case "email":
+		addr, err := mail.ParseAddress(str)
+		valid = err == nil && addr.Address == str
+	case "uri":
+		u, err := url.Parse(str)
+		valid = err == nil && u.Scheme != ""
+	case "uuid":
+		valid = uuidPattern.MatchString(str)
+	default:
+		return
+	}
+	if !valid {
+		v.Addf(field, "format", "must be a valid %s", s.format)
+	}
+}
+
+func sortedKeys(obj map[string]interface{}) []string {
+	keys := make([]string, 0, len(obj))
+	for key := range obj {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// ValidateRequests returns an http.Handler that validates JSON request
+// bodies against schema before passing requests to h. Requests without a
+// body are passed through. Bodies are read with DefaultDecoder's size limit
+// and Content-Type check, so non-JSON bodies get a
+// wherr.UnsupportedMediaType error. Violations are handled like Render
+// handles errors, with a wherr.UnprocessableEntity validation error listing
+// every violation. The schema name is listed as the "Request schema" whroute
+// annotation.
+func ValidateRequests(schema *Schema, h http.Handler) http.Handler {
+	return schemaHandler{
+		annotation: "Request schema",
+		schema:     schema,
+		h:          h,
+		fn: func(w http.ResponseWriter, r *http.Request) {
+			if r.Body == nil || r.ContentLength == 0 {
+				h.ServeHTTP(w, r)
+				return
+			}
+			if !DefaultDecoder.AnyContentType {
+				err := checkContentType(r.Header.Get("Content-Type"))
+				if err != nil {
+					handleError(w, r, err)
+					return
+				}
+			}
+			body := r.Body
+			defer body.Close()
+			data, err := DefaultDecoder.readAll(body)
+			if err != nil {
+				handleError(w, r, err)
+				return
+			}
+			if len(bytes.TrimSpace(data)) > 0 {
+				err = schema.ValidateJSON(data)
+				if err != nil {
+					handleError(w, r, err)
+					return
+				}
+			}
+			r.Body = ioutil.NopCloser(bytes.NewReader(data))
+			h.ServeHTTP(w, r)
+		}}
+}
+
+// DevValidateResponses returns an http.Handler that makes Render (and
+// Endpoint) validate response values against schema. Responses that don't
+// match are logged and replaced with a wherr.InternalServerError, so schema
+// drift is caught early. This costs an extra marshal and unmarshal per
+// response, so it's intended for development and testing. The schema name is
+// listed as the "Response schema" whroute annotation.
+func DevValidateResponses(schema *Schema, h http.Handler) http.Handler {
+	return schemaHandler{
+		annotation: "Response schema",
+		schema:     schema,
+		h:          h,
+		fn: func(w http.ResponseWriter, r *http.Request) {
+			h.ServeHTTP(w, whcompat.WithContext(r, context.WithValue(
+				whcompat.Context(r), responseSchemaKey, schema)))
+		}}
+}
+
+// checkResponse validates value against the response schema bound with
+// DevValidateResponses, if any.
+func checkResponse(r *http.Request, value interface{}) error {
+	schema, ok := whcompat.Context(r).Value(responseSchemaKey).(*Schema)
+	if !ok {
+		return nil
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	var doc interface{}
+	err = json.Unmarshal(data, &doc)
+	if err != nil {
+		return err
+	}
+	violations := schema.Validate(doc)
+	if len(violations) == 0 {
+		return nil
+	}
+	log.Printf("response failed schema %q: %v", schema.Name(), violations)
+	return wherr.InternalServerError.New("response failed schema %q: %v",
+		schema.Name(), violations)
+}
+
+type schemaHandler struct {
+	annotation string
+	schema     *Schema
+	h          http.Handler
+	fn         func(w http.ResponseWriter, r *http.Request)
+}
+
+func (sh schemaHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	sh.fn(w, r)
+}
+
+// Routes implements whroute.Lister
+func (sh schemaHandler) Routes(
+	cb func(method, path string, annotations map[string]string)) {
+	whroute.Routes(sh.h,
+		func(method, path string, annotations map[string]string) {
+			cp := make(map[string]string, len(annotations)+1)
+			for key, val := range annotations {
+				cp[key] = val
+			}
+			cp[sh.annotation] = sh.schema.Name()
+			cb(method, path, cp)
+		})
+}
+
+var _ http.Handler = schemaHandler{}
+var _ whroute.Lister = schemaHandler{}
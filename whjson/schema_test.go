@@ -0,0 +1,163 @@
+// Copyright (C) 2017 JT Olds
+// See LICENSE for copying information
+
+package whjson_test
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+
+	"gopkg.in/webhelp.v1/wherr"
+	"gopkg.in/webhelp.v1/whjson"
+	"gopkg.in/webhelp.v1/whroute"
+)
+
+var userSchema = whjson.MustParseSchema(`{
+	"title": "User",
+	"type": "object",
+	"required": ["email", "age"],
+	"additionalProperties": false,
+	"properties": {
+		"email": {"type": "string", "format": "email"},
+		"age": {"type": "integer", "minimum": 0},
+		"tags": {"type": "array", "items": {"enum": ["a", "b"]},
+			"uniqueItems": true}
+	}
+}`)
+
+func TestSchemaValidateJSON(t *testing.T) {
+	for _, test := range []struct {
+		doc    string
+		fields []string
+	}{
+		{`{"email": "jt@example.com", "age": 3, "tags": ["a"]}`, nil},
+		{`{"email": "nope", "age": -1}`, []string{"age", "email"}},
+		{`{"age": 1.5, "extra": true}`, []string{"age", "email", "extra"}},
+		{`{"email": "jt@example.com", "age": 3, "tags": ["a", "c", "a"]}`,
+			[]string{"tags", "tags.1"}},
+		{`[]`, []string{"."}},
+	} {
+		err := userSchema.ValidateJSON([]byte(test.doc))
+		var fields []string
+		for _, field := range wherr.FieldErrors(err) {
+			fields = append(fields, field.Field)
+		}
+		sort.Strings(fields)
+		if strings.Join(fields, ",") != strings.Join(test.fields, ",") {
+			t.Errorf("%s: expected %v, got %v (%v)", test.doc, test.fields,
+				fields, err)
+		}
+	}
+}
+
+func TestSchemaHandlers(t *testing.T) {
+	handler := whjson.ValidateRequests(userSchema,
+		whjson.DevValidateResponses(userSchema, http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				var user map[string]interface{}
+				whjson.MustDecode(r, &user)
+				user["age"] = "old"
+				whjson.Render(w, r, user)
+			})))
+
+	r := httptest.NewRequest("POST", "/", bytes.NewBufferString(`{"age": 3}`))
+	r.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	if w.Code != 422 || !strings.Contains(w.Body.String(), "email") {
+		t.Fatalf("unexpected response: %d %s", w.Code, w.Body.String())
+	}
+
+	r = httptest.NewRequest("POST", "/",
+		bytes.NewBufferString(`{"age": 3, "email": "jt@example.com"}`))
+	r.Header.Set("Content-Type", "application/json")
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	if w.Code != 500 {
+		t.Fatalf("unexpected response: %d %s", w.Code, w.Body.String())
+	}
+
+	r = httptest.NewRequest("POST", "/", strings.NewReader("age=3"))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	if w.Code != 415 {
+		t.Fatalf("unexpected response: %d %s", w.Code, w.Body.String())
+	}
+
+	// a MaxBodySize of zero means no limit.
+	defer func(size int64) { whjson.DefaultDecoder.MaxBodySize = size }(
+		whjson.DefaultDecoder.MaxBodySize)
+	whjson.DefaultDecoder.MaxBodySize = 0
+	r = httptest.NewRequest("POST", "/", bytes.NewBufferString(`{"age": 3}`))
+	r.Header.Set("Content-Type", "application/json")
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	if w.Code != 422 {
+		t.Fatalf("unexpected response: %d %s", w.Code, w.Body.String())
+	}
+
+	var out bytes.Buffer
+	whroute.PrintRoutes(&out, handler)
+	if !strings.Contains(out.String(), "Request schema: User") ||
+		!strings.Contains(out.String(), "Response schema: User") {
+		t.Fatalf("unexpected routes: %s", out.String())
+	}
+}
+
+func TestSchemaKeywords(t *testing.T) {
+	tree := whjson.MustParseSchema(`{
+		"$schema": "http://json-schema.org/draft-07/schema#",
+		"description": "a tree",
+		"$ref": "#/definitions/node",
+		"definitions": {
+			"node": {
+				"type": "object",
+				"required": ["name"],
+				"properties": {
+					"name": {"type": "string"},
+					"children": {"type": "array",
+						"items": {"$ref": "#/definitions/node"}}
+				}
+			}
+		}
+	}`)
+	if err := tree.ValidateJSON([]byte(
+		`{"name": "a", "children": [{"name": "b"}]}`)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	err := tree.ValidateJSON([]byte(`{"name": "a", "children": [{}]}`))
+	if fields := wherr.FieldMap(err); fields["children.0.name"] == nil {
+		t.Fatalf("expected nested required error, got %v", err)
+	}
+
+	for _, schema := range []string{
+		`{"patternProperties": {"^x": {}}}`,
+		`{"properties": {"a": {"if": {}, "then": {}}}}`,
+		`{"$ref": "other.json#/definitions/a"}`,
+		`{"$ref": "#/definitions/missing"}`,
+		`{"definitions": {"a": {"dependencies": {}}}}`,
+	} {
+		if _, err := whjson.ParseSchema([]byte(schema)); err == nil {
+			t.Fatalf("expected error for %s", schema)
+		}
+	}
+}
+
+func TestSchemaMultipleOf(t *testing.T) {
+	price := whjson.MustParseSchema(`{"type": "number", "multipleOf": 0.1}`)
+	for _, doc := range []string{`0.3`, `0.7`, `1.1`, `12345.6`, `-0.3`} {
+		if err := price.ValidateJSON([]byte(doc)); err != nil {
+			t.Errorf("%s: unexpected error: %v", doc, err)
+		}
+	}
+	for _, doc := range []string{`0.35`, `1.01`} {
+		if err := price.ValidateJSON([]byte(doc)); err == nil {
+			t.Errorf("%s: expected error", doc)
+		}
+	}
+}
@@ -0,0 +1,263 @@
+// Copyright (C) 2017 JT Olds
+// See LICENSE for copying information
+
+package whjson
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"net/http"
+	"reflect"
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+	"gopkg.in/webhelp.v1/whcompat"
+	"gopkg.in/webhelp.v1/wherr"
+)
+
+// Iterator produces the values a stream writes. It returns ok = false once
+// there are no more values. Iterators should return promptly with ctx.Err()
+// when ctx is canceled.
+type Iterator func(ctx context.Context) (value interface{}, ok bool,
+	err error)
+
+// ChanIterator returns an Iterator that yields values received from ch, which
+// must be a channel that can be received from, until ch is closed.
+func ChanIterator(ch interface{}) Iterator {
+	chv := reflect.ValueOf(ch)
+	if chv.Kind() != reflect.Chan ||
+		chv.Type().ChanDir()&reflect.RecvDir == 0 {
+		panic(fmt.Sprintf("whjson: ChanIterator needs a receivable channel, "+
+			"not %T", ch))
+	}
+	return func(ctx context.Context) (interface{}, bool, error) {
+		chosen, val, ok := reflect.Select([]reflect.SelectCase{
+			{Dir: reflect.SelectRecv, Chan: chv},
+			{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(ctx.Done())}})
+		if chosen == 1 {
+			return nil, false, ctx.Err()
+		}
+		if !ok {
+			return nil, false, nil
+		}
+		return val.Interface(), true, nil
+	}
+}
+
+// SliceIterator returns an Iterator that yields the elements of the given
+// slice.
+func SliceIterator(slice interface{}) Iterator {
+	v := reflect.ValueOf(slice)
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+		panic(fmt.Sprintf("whjson: SliceIterator needs a slice, not %T",
+			slice))
+	}
+	i := 0
+	return func(ctx context.Context) (interface{}, bool, error) {
+		if err := ctx.Err(); err != nil {
+			return nil, false, err
+		}
+		if i >= v.Len() {
+			return nil, false, nil
+		}
+		i++
+		return v.Index(i - 1).Interface(), true, nil
+	}
+}
+
+var (
+	// DefaultStreamer is the Streamer used by StreamArray and StreamNDJSON.
+	DefaultStreamer = Streamer{
+		FlushEvery:    100,
+		FlushInterval: time.Second}
+)
+
+// Streamer writes values from an Iterator as they're produced, instead of
+// marshaling a whole document up front like Render does.
+//
+// Errors (including from the Iterator) that happen before anything was
+// written are handled like Render handles them. Once the response has
+// started, the status can't be changed anymore. Newline-delimited JSON
+// streams then end with a final error object like `{"err": "message"}`, while
+// JSON array streams log the error and abort the connection (see
+// http.ErrAbortHandler), so the client sees an incomplete document instead
+// of a misleadingly complete one. If the request context is canceled, the
+// stream stops without writing anything further.
+type Streamer struct {
+	// FlushEvery flushes the response (if the http.ResponseWriter is an
+	// http.Flusher) after this many values. Zero means don't flush based on
+	// count.
+	FlushEvery int
+
+	// FlushInterval flushes the response (if the http.ResponseWriter is an
+	// http.Flusher) this often while anything is buffered, even while the
+	// Iterator is still waiting for the next value, so slow producers don't
+	// hold back values already written. Zero means don't flush based on time.
+	FlushInterval time.Duration
+}
+
+// StreamArray streams values from it with DefaultStreamer as a JSON array.
+func StreamArray(w http.ResponseWriter, r *http.Request, it Iterator) {
+	DefaultStreamer.StreamArray(w, r, it)
+}
+
+// StreamNDJSON streams values from it with DefaultStreamer as
+// newline-delimited JSON.
+func StreamNDJSON(w http.ResponseWriter, r *http.Request, it Iterator) {
+	DefaultStreamer.StreamNDJSON(w, r, it)
+}
+
+// StreamArray writes the values from it as a JSON array, inside the
+// envelope of the request's Encoder (see EncodeWith) if it has one, like
+// `{"resp": [<value>, <value>, ...]}`.
+func (s Streamer) StreamArray(w http.ResponseWriter, r *http.Request,
+	it Iterator) {
+	e := EncoderFor(r)
+	prefix, suffix := "[", "]\n"
+	if e.Envelope {
+		key, err := e.Marshal(r, e.responseKey())
+		if err != nil {
+			handleError(w, r, err)
+			return
+		}
+		prefix, suffix = "{"+string(key)+":[", "]}\n"
+	}
+	s.stream(w, r, it, streamFormat{
+		contentType: "application/json",
+		prefix:      prefix,
+		separator:   ",\n",
+		suffix:      suffix,
+		lateError: func(bw *bufio.Writer, err error) {
+			log.Printf("error after stream started, aborting: %v", err)
+			panic(http.ErrAbortHandler)
+		}})
+}
+
+// StreamNDJSON writes the values from it as newline-delimited JSON, one
+// value per line. Values are never wrapped in an envelope.
+func (s Streamer) StreamNDJSON(w http.ResponseWriter, r *http.Request,
+	it Iterator) {
+	e := EncoderFor(r)
+	s.stream(w, r, it, streamFormat{
+		contentType: "application/x-ndjson",
+		separator:   "\n",
+		suffix:      "\n",
+		lateError: func(bw *bufio.Writer, err error) {
+			log.Printf("error after stream started: %v", err)
+			data, merr := (&Encoder{EscapeHTML: e.EscapeHTML}).Marshal(r,
+				map[string]string{e.errorKey(): wherr.Message(r, err)})
+			if merr != nil {
+				return
+			}
+			bw.WriteString("\n")
+			bw.Write(data)
+			bw.WriteString("\n")
+		}})
+}
+
+type streamFormat struct {
+	contentType               string
+	prefix, separator, suffix string
+	lateError                 func(bw *bufio.Writer, err error)
+}
+
+func (s Streamer) stream(w http.ResponseWriter, r *http.Request,
+	it Iterator, format streamFormat) {
+	ctx := whcompat.Context(r)
+	// items are always written compactly, one per line
+	enc := &Encoder{EscapeHTML: EncoderFor(r).EscapeHTML}
+
+	value, ok, err := it(ctx)
+	var data []byte
+	if err == nil && ok {
+		data, err = enc.Marshal(r, value)
+	}
+	if err != nil {
+		handleError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", format.contentType)
+	w.WriteHeader(http.StatusOK)
+	bw := bufio.NewWriter(w)
+	flusher, canFlush := w.(http.Flusher)
+	defer bw.Flush()
+
+	// bw is shared with the interval flusher, so it's only touched with mtx
+	// held until stopFlusher is called.
+	var mtx sync.Mutex
+	dirty := false
+	flush := func() {
+		if bw.Flush() == nil && canFlush {
+			flusher.Flush()
+		}
+		dirty = false
+	}
+	stopFlusher := func() {}
+	if s.FlushInterval > 0 {
+		ticker := time.NewTicker(s.FlushInterval)
+		stop, stopped := make(chan struct{}), make(chan struct{})
+		go func() {
+			defer close(stopped)
+			for {
+				select {
+				case <-stop:
+					return
+				case <-ticker.C:
+					mtx.Lock()
+					if dirty {
+						flush()
+					}
+					mtx.Unlock()
+				}
+			}
+		}()
+		var once sync.Once
+		stopFlusher = func() {
+			once.Do(func() {
+				ticker.Stop()
+				close(stop)
+				<-stopped
+			})
+		}
+		defer stopFlusher()
+	}
+
+	mtx.Lock()
+	bw.WriteString(format.prefix)
+	mtx.Unlock()
+	count := 0
+	for ; ok; count++ {
+		mtx.Lock()
+		if count > 0 {
+			bw.WriteString(format.separator)
+		}
+		bw.Write(data)
+		dirty = true
+		if s.FlushEvery > 0 && (count+1)%s.FlushEvery == 0 {
+			flush()
+		}
+		mtx.Unlock()
+
+		value, ok, err = it(ctx)
+		if err == nil && ok {
+			data, err = enc.Marshal(r, value)
+		}
+		if ctx.Err() != nil {
+			// the client went away or the request was otherwise canceled, so
+			// there's nobody left to tell.
+			return
+		}
+		if err != nil {
+			stopFlusher()
+			format.lateError(bw, err)
+			return
+		}
+	}
+	stopFlusher()
+	if count > 0 || format.prefix != "" {
+		bw.WriteString(format.suffix)
+	}
+}
@@ -0,0 +1,121 @@
+// Copyright (C) 2017 JT Olds
+// See LICENSE for copying information
+
+package whjson_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+	"gopkg.in/webhelp.v1/wherr"
+	"gopkg.in/webhelp.v1/whjson"
+)
+
+func TestStream(t *testing.T) {
+	failing := func(ctx context.Context) (interface{}, bool, error) {
+		return nil, false, wherr.Conflict.New("failed")
+	}
+	then := func(first, second whjson.Iterator) whjson.Iterator {
+		return func(ctx context.Context) (interface{}, bool, error) {
+			val, ok, err := first(ctx)
+			if ok || err != nil {
+				return val, ok, err
+			}
+			return second(ctx)
+		}
+	}
+
+	ch := make(chan int, 3)
+	ch <- 1
+	ch <- 2
+	close(ch)
+
+	w := httptest.NewRecorder()
+	whjson.StreamArray(w, httptest.NewRequest("GET", "/", nil),
+		whjson.ChanIterator(ch))
+	if w.Body.String() != "{\"resp\":[1,\n2]}\n" {
+		t.Fatalf("unexpected array: %q", w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	whjson.StreamNDJSON(w, httptest.NewRequest("GET", "/", nil),
+		whjson.SliceIterator([]string{"a", "b"}))
+	if w.Body.String() != "\"a\"\n\"b\"\n" {
+		t.Fatalf("unexpected ndjson: %q", w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	whjson.StreamNDJSON(w, httptest.NewRequest("GET", "/", nil), failing)
+	if w.Code != 409 {
+		t.Fatalf("unexpected early error response: %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	whjson.StreamNDJSON(w, httptest.NewRequest("GET", "/", nil),
+		then(whjson.SliceIterator([]int{1}), failing))
+	if w.Code != 200 || w.Body.String() != "1\n{\"err\":\"failed\"}\n" {
+		t.Fatalf("unexpected late error response: %d %q", w.Code,
+			w.Body.String())
+	}
+
+	func() {
+		defer func() {
+			if rec := recover(); rec == nil {
+				t.Fatal("expected array stream to abort")
+			}
+		}()
+		whjson.StreamArray(httptest.NewRecorder(),
+			httptest.NewRequest("GET", "/", nil),
+			then(whjson.SliceIterator([]int{1}), failing))
+	}()
+}
+
+func TestStreamFlushInterval(t *testing.T) {
+	release := make(chan int)
+	values := make(chan int)
+	go func() {
+		values <- 1
+		values <- <-release
+		close(values)
+	}()
+	streamer := whjson.Streamer{FlushInterval: 10 * time.Millisecond}
+	server := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			streamer.StreamNDJSON(w, r, whjson.ChanIterator(values))
+		}))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	// the first value has to arrive while the iterator is still waiting for
+	// the second.
+	first := make(chan string, 1)
+	go func() {
+		buf := make([]byte, 1)
+		n, _ := io.ReadFull(resp.Body, buf)
+		first <- string(buf[:n])
+	}()
+	select {
+	case val := <-first:
+		if val != "1" {
+			t.Fatalf("unexpected first value %q", val)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("first value not flushed while waiting for the second")
+	}
+	release <- 2
+
+	rest := make([]byte, 64)
+	n, _ := io.ReadFull(resp.Body, rest)
+	if string(rest[:n]) != "\n2\n" {
+		t.Fatalf("unexpected rest of stream %q", rest[:n])
+	}
+}
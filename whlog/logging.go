@@ -31,6 +31,12 @@ func LogResponses(logger Loggerf, h http.Handler) http.Handler {
 
 			defer func() {
 				rec := recover()
+				if rec == http.ErrAbortHandler {
+					logger(`%s %#v %d %d %d %v aborted`, method, requestURI,
+						rw.StatusCode(), r.ContentLength, rw.Written(),
+						time.Since(start))
+					panic(rec)
+				}
 				if rec != nil {
 					log.Printf("Panic: %v", rec)
 					panic(rec)
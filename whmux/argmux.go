@@ -15,6 +15,34 @@ import (
 	"gopkg.in/webhelp.v1/whroute"
 )
 
+var pathArgsKey = webhelp.GenSym()
+
+// withPathArg stores val in ctx under arg's key, and also under name, unless
+// it's empty, so PathArg can find it.
+func withPathArg(ctx context.Context, arg interface{}, val interface{},
+	name, str string) context.Context {
+	ctx = context.WithValue(ctx, arg, val)
+	if name == "" {
+		return ctx
+	}
+	existing, _ := ctx.Value(pathArgsKey).(map[string]string)
+	args := make(map[string]string, len(existing)+1)
+	for key, val := range existing {
+		args[key] = val
+	}
+	args[name] = str
+	return context.WithValue(ctx, pathArgsKey, args)
+}
+
+// PathArg returns the unparsed value of the path argument with the given
+// name, as created by NewNamedStringArg or NewNamedIntArg, and ok = false if
+// no such argument was shifted off of the request path.
+func PathArg(ctx context.Context, name string) (val string, ok bool) {
+	args, _ := ctx.Value(pathArgsKey).(map[string]string)
+	val, ok = args[name]
+	return val, ok
+}
+
 // StringArg is a way to pull off arbitrary path elements from an incoming
 // URL. You'll need to create one with NewStringArg.
 type StringArg webhelp.ContextKey
@@ -23,6 +51,31 @@ func NewStringArg() StringArg {
 	return StringArg(webhelp.GenSym())
 }
 
+// NamedStringArg is a StringArg that can also be retrieved by name with
+// PathArg. You'll need to create one with NewNamedStringArg.
+type NamedStringArg struct {
+	StringArg
+	name string
+}
+
+// NewNamedStringArg is like NewStringArg, but the argument can also be
+// retrieved by name with PathArg, which is how packages such as whjson find
+// path arguments without having to be given the StringArg itself.
+func NewNamedStringArg(name string) NamedStringArg {
+	return NamedStringArg{StringArg: NewStringArg(), name: name}
+}
+
+// Shift is like StringArg.Shift, but also stores the argument by name.
+func (a NamedStringArg) Shift(h http.Handler) http.Handler {
+	return a.ShiftOpt(h, notFoundHandler{})
+}
+
+// ShiftOpt is like StringArg.ShiftOpt, but also stores the argument by name.
+func (a NamedStringArg) ShiftOpt(found, notfound http.Handler) http.Handler {
+	return stringOptShift{a: a.StringArg, name: a.name, found: found,
+		notfound: notfound}
+}
+
 // Shift takes an http.Handler and returns a new http.Handler that does
 // additional request processing. When an incoming request is processed, the
 // new http.Handler pulls the next path element off of the incoming request
@@ -35,6 +88,7 @@ func (a StringArg) Shift(h http.Handler) http.Handler {
 
 type stringOptShift struct {
 	a               StringArg
+	name            string
 	found, notfound http.Handler
 }
 
@@ -51,7 +105,7 @@ func (ssi stringOptShift) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	r.URL.Path = newpath
-	ctx := context.WithValue(whcompat.Context(r), ssi.a, arg)
+	ctx := withPathArg(whcompat.Context(r), ssi.a, arg, ssi.name, arg)
 	ssi.found.ServeHTTP(w, whcompat.WithContext(r, ctx))
 }
 
@@ -90,6 +144,30 @@ func NewIntArg() IntArg {
 	return IntArg(webhelp.GenSym())
 }
 
+// NamedIntArg is an IntArg that can also be retrieved by name with PathArg.
+// You'll need to create one with NewNamedIntArg.
+type NamedIntArg struct {
+	IntArg
+	name string
+}
+
+// NewNamedIntArg is like NewIntArg, but the argument can also be retrieved
+// by name with PathArg.
+func NewNamedIntArg(name string) NamedIntArg {
+	return NamedIntArg{IntArg: NewIntArg(), name: name}
+}
+
+// Shift is like IntArg.Shift, but also stores the argument by name.
+func (a NamedIntArg) Shift(h http.Handler) http.Handler {
+	return a.ShiftOpt(h, notFoundHandler{})
+}
+
+// ShiftOpt is like IntArg.ShiftOpt, but also stores the argument by name.
+func (a NamedIntArg) ShiftOpt(found, notfound http.Handler) http.Handler {
+	return intOptShift{a: a.IntArg, name: a.name, found: found,
+		notfound: notfound}
+}
+
 type notFoundHandler struct{}
 
 func (notFoundHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
@@ -113,6 +191,7 @@ func (a IntArg) Shift(h http.Handler) http.Handler {
 
 type intOptShift struct {
 	a               IntArg
+	name            string
 	found, notfound http.Handler
 }
 
@@ -130,7 +209,7 @@ func (isi intOptShift) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	r.URL.Path = newpath
-	ctx := context.WithValue(whcompat.Context(r), isi.a, val)
+	ctx := withPathArg(whcompat.Context(r), isi.a, val, isi.name, str)
 	isi.found.ServeHTTP(w, whcompat.WithContext(r, ctx))
 }
 
@@ -0,0 +1,90 @@
+// Copyright (C) 2017 JT Olds
+// See LICENSE for copying information
+
+package whparse
+
+import (
+	"gopkg.in/webhelp.v1/internal/accept"
+)
+
+// Preference is one element of an Accept-style header, like
+// "text/html;level=1;q=0.8" or "en-GB;q=0.5".
+type Preference struct {
+	// Value is the media range, language range, or content coding,
+	// lowercased, like "text/*", "en-gb", or "gzip".
+	Value string
+
+	// Params holds media type parameters other than q, with lowercased names.
+	// It's nil for other headers.
+	Params map[string]string
+
+	// Q is the quality value, from 0 to 1. It defaults to 1.
+	Q float64
+}
+
+// ParseAccept parses an Accept header into preferences, most preferred first.
+// Preferences are sorted by quality value, then specificity (so "text/html"
+// comes before "text/*", which comes before "*/*"), then by order in the
+// header.
+func ParseAccept(header string) ([]Preference, error) {
+	return parse(header, accept.Accept)
+}
+
+// ParseAcceptLanguage parses an Accept-Language header into preferences,
+// most preferred first. Preferences are sorted by quality value, then
+// specificity (so "en-gb" comes before "en", which comes before "*"), then by
+// order in the header.
+func ParseAcceptLanguage(header string) ([]Preference, error) {
+	return parse(header, accept.AcceptLanguage)
+}
+
+// ParseAcceptEncoding parses an Accept-Encoding header into preferences,
+// most preferred first. Preferences are sorted by quality value, then
+// specificity (so "*" comes last among equals), then by order in the header.
+func ParseAcceptEncoding(header string) ([]Preference, error) {
+	return parse(header, accept.AcceptEncoding)
+}
+
+// NegotiateContentType returns the offered media type that the Accept header
+// prefers most, or false if none are acceptable. Each offer gets the
+// quality value of the most specific media range that matches it, where
+// ranges with parameters only match offers with the same parameters, and an
+// offer with a quality value of zero is not acceptable. Ties go to the
+// earliest offer. An empty header accepts everything, so the first offer is
+// returned. Malformed elements of the header are ignored.
+func NegotiateContentType(header string, offers ...string) (string, bool) {
+	return accept.Negotiate(header, accept.Accept, offers)
+}
+
+// NegotiateLanguage returns the offered language tag that the
+// Accept-Language header prefers most, or false if none are acceptable.
+// Each offer gets the quality value of the most specific language range that
+// matches it. A range matches offers it is a prefix of, so "en" matches
+// "en-GB", and falls back to offers that are a prefix of it, so "en-GB"
+// matches "en" if no range matches "en" directly. "*" matches anything, but
+// is less specific than a fallback. Otherwise, negotiation works like
+// NegotiateContentType.
+func NegotiateLanguage(header string, offers ...string) (string, bool) {
+	return accept.Negotiate(header, accept.AcceptLanguage, offers)
+}
+
+// NegotiateEncoding returns the offered content coding, like "gzip" or
+// "identity", that the Accept-Encoding header prefers most, or false if none
+// are acceptable. "identity" is acceptable unless the header excludes it
+// with a quality value of zero, either by name or with "*". Otherwise,
+// negotiation works like NegotiateContentType.
+func NegotiateEncoding(header string, offers ...string) (string, bool) {
+	return accept.Negotiate(header, accept.AcceptEncoding, offers)
+}
+
+func parse(header string, kind accept.Kind) ([]Preference, error) {
+	prefs, err := accept.Parse(header, kind, true)
+	if err != nil {
+		return nil, err
+	}
+	var rv []Preference
+	for _, pref := range prefs {
+		rv = append(rv, Preference(pref))
+	}
+	return rv, nil
+}
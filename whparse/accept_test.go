@@ -0,0 +1,85 @@
+// Copyright (C) 2017 JT Olds
+// See LICENSE for copying information
+
+package whparse_test
+
+import (
+	"strings"
+	"testing"
+
+	"gopkg.in/webhelp.v1/whparse"
+)
+
+func TestParseAccept(t *testing.T) {
+	prefs, err := whparse.ParseAccept(
+		"text/*;q=0.5, */*;q=0.1, text/html;level=1;q=0.5, Application/JSON")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, pref := range prefs {
+		got = append(got, pref.Value)
+	}
+	if strings.Join(got, " ") != "application/json text/html text/* */*" {
+		t.Fatalf("unexpected order: %v", got)
+	}
+	if prefs[1].Params["level"] != "1" || prefs[1].Q != 0.5 {
+		t.Fatalf("unexpected preference: %#v", prefs[1])
+	}
+
+	for _, header := range []string{"text", "*/html", "text/html;q=2",
+		"text/html;q=x"} {
+		if _, err := whparse.ParseAccept(header); err == nil {
+			t.Fatalf("expected error for %#v", header)
+		}
+	}
+	if _, err := whparse.ParseAcceptLanguage("en_US"); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestNegotiate(t *testing.T) {
+	for _, test := range []struct {
+		negotiate func(header string, offers ...string) (string, bool)
+		header    string
+		offers    []string
+		expected  string
+	}{
+		{whparse.NegotiateContentType, "",
+			[]string{"application/json", "text/html"}, "application/json"},
+		{whparse.NegotiateContentType, "text/html, application/*;q=0.9",
+			[]string{"application/json", "text/html"}, "text/html"},
+		{whparse.NegotiateContentType, "*/*, application/json;q=0",
+			[]string{"application/json", "text/html"}, "text/html"},
+		{whparse.NegotiateContentType, "text/html;level=1",
+			[]string{"text/html", "text/html;level=1"}, "text/html;level=1"},
+		{whparse.NegotiateContentType, "image/png",
+			[]string{"application/json"}, ""},
+		{whparse.NegotiateContentType, "bogus, text/csv",
+			[]string{"application/json", "text/csv"}, "text/csv"},
+
+		{whparse.NegotiateLanguage, "en-GB, fr;q=0.8",
+			[]string{"fr", "en"}, "en"},
+		{whparse.NegotiateLanguage, "en", []string{"fr", "en-US"}, "en-US"},
+		{whparse.NegotiateLanguage, "en-GB, en-US;q=0.9, *;q=0.1",
+			[]string{"de", "en-US", "en"}, "en"},
+		{whparse.NegotiateLanguage, "fr, *;q=0.1", []string{"de", "fr-CA"},
+			"fr-CA"},
+		{whparse.NegotiateLanguage, "fr", []string{"de"}, ""},
+
+		{whparse.NegotiateEncoding, "gzip;q=0.5, br",
+			[]string{"gzip", "br", "identity"}, "br"},
+		{whparse.NegotiateEncoding, "gzip;q=0.5",
+			[]string{"gzip", "identity"}, "identity"},
+		{whparse.NegotiateEncoding, "br, *;q=0", []string{"gzip", "identity"},
+			""},
+		{whparse.NegotiateEncoding, "br, identity;q=0",
+			[]string{"identity"}, ""},
+	} {
+		got, ok := test.negotiate(test.header, test.offers...)
+		if got != test.expected || ok != (test.expected != "") {
+			t.Fatalf("%#v %v: expected %#v, got %#v, %v", test.header,
+				test.offers, test.expected, got, ok)
+		}
+	}
+}
@@ -0,0 +1,243 @@
+// Copyright (C) 2017 JT Olds
+// See LICENSE for copying information
+
+package whparse
+
+import (
+	"encoding"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strconv"
+	"time"
+
+	"gopkg.in/webhelp.v1/whcompat"
+	"gopkg.in/webhelp.v1/wherr"
+	"gopkg.in/webhelp.v1/whmux"
+)
+
+var (
+	durationType        = reflect.TypeOf(time.Duration(0))
+	textUnmarshalerType = reflect.TypeOf(
+		(*encoding.TextUnmarshaler)(nil)).Elem()
+
+	// bindSources are the struct tags Bind looks at, in order of precedence.
+	bindSources = []string{"path", "query", "form", "header"}
+)
+
+// Bind fills in the struct dst points to from r, using struct tags to say
+// where each field's value comes from:
+//
+//   type ListReq struct {
+//     UserID int64     `path:"id"`
+//     Limit  int       `query:"limit" default:"20"`
+//     Tags   []string  `query:"tag"`
+//     Since  time.Time `query:"since" required:"true"`
+//     Name   string    `form:"name"`
+//     Token  string    `header:"X-Token"`
+//   }
+//
+// path values are named path arguments (see whmux.NewNamedStringArg), query
+// values come from the URL query, form values come from the request body
+// (see http.Request.PostForm), and header values come from request headers.
+// The body is only parsed if there are form tags. If Bind parses a
+// multipart/form-data body, it removes any temporary files the uploads were
+// stored in afterwards, so use whupload for requests with files.
+// If a field has more than one of these tags, the first one in that order
+// with a value wins.
+//
+// Strings, bools (see ParseBool), integers, floats, time.Duration (see
+// time.ParseDuration), and encoding.TextUnmarshalers (including time.Time,
+// which takes RFC 3339) are supported, as are pointers to and slices of
+// those. Slices get every value given, other types the first.
+//
+// Bind only sets fields it finds values for, so dst can be filled in ahead of
+// time, say from a JSON body. A field's default tag is only used if the
+// field is still its zero value, and a field with a required:"true" tag is
+// only an error if it has no value and is still its zero value.
+//
+// All problems are reported together as a wherr.BadRequest error with a
+// field error (see wherr.FieldErrors) per field, with code "required" or
+// "invalid".
+func Bind(r *http.Request, dst interface{}) error {
+	v := reflect.ValueOf(dst)
+	if v.Kind() != reflect.Ptr || v.IsNil() ||
+		v.Elem().Kind() != reflect.Struct {
+		return wherr.InternalServerError.New(
+			"whparse: Bind needs a pointer to a struct, not %T", dst)
+	}
+	b := binder{r: r}
+	b.bind(v.Elem())
+	if b.parsedMultipart && r.MultipartForm != nil {
+		// Bind only needs the values, so don't leave uploads that didn't
+		// fit in memory on disk.
+		r.MultipartForm.RemoveAll()
+	}
+	if b.err != nil {
+		return b.err
+	}
+	return b.validation.ErrWith(wherr.BadRequest)
+}
+
+type binder struct {
+	r               *http.Request
+	parsedForm      bool
+	parsedMultipart bool
+	validation      wherr.Validation
+	err             error
+}
+
+func (b *binder) values(source, name string) []string {
+	switch source {
+	case "path":
+		if val, ok := whmux.PathArg(whcompat.Context(b.r), name); ok {
+			return []string{val}
+		}
+	case "query":
+		return b.r.URL.Query()[name]
+	case "form":
+		if !b.parsedForm {
+			b.parsedForm = true
+			b.parsedMultipart = b.r.MultipartForm == nil
+			err := b.r.ParseMultipartForm(32 << 20)
+			if err == http.ErrNotMultipart {
+				b.parsedMultipart = false
+			} else if err != nil {
+				b.err = wherr.BadRequest.New("invalid form: %v", err)
+			}
+		}
+		return b.r.PostForm[name]
+	case "header":
+		return b.r.Header[http.CanonicalHeaderKey(name)]
+	}
+	return nil
+}
+
+func (b *binder) bind(v reflect.Value) {
+	typ := v.Type()
+	for i := 0; i < typ.NumField() && b.err == nil; i++ {
+		field := typ.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+
+		var name, source string
+		var vals []string
+		for _, src := range bindSources {
+			tagName := field.Tag.Get(src)
+			if tagName == "" || tagName == "-" {
+				continue
+			}
+			if name == "" {
+				name, source = tagName, src
+			}
+			if vals = b.values(src, tagName); len(vals) > 0 {
+				name, source = tagName, src
+				break
+			}
+		}
+		if name == "" {
+			continue
+		}
+
+		fv := v.Field(i)
+		if len(vals) == 0 {
+			if !isZero(fv) {
+				continue
+			}
+			if def, ok := field.Tag.Lookup("default"); ok {
+				vals = []string{def}
+			} else {
+				required, _ := ParseBool(field.Tag.Get("required"))
+				if required {
+					b.validation.Addf(name, "required", "missing %s value",
+						source)
+				}
+				continue
+			}
+		}
+
+		err := setValue(fv, vals)
+		if err != nil {
+			b.validation.Addf(name, "invalid", "invalid %s value %#v: %v",
+				source, vals[0], err)
+		}
+	}
+}
+
+func isZero(v reflect.Value) bool {
+	return reflect.DeepEqual(v.Interface(),
+		reflect.Zero(v.Type()).Interface())
+}
+
+func setValue(v reflect.Value, vals []string) error {
+	if reflect.PtrTo(v.Type()).Implements(textUnmarshalerType) {
+		return v.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText(
+			[]byte(vals[0]))
+	}
+
+	switch v.Kind() {
+	case reflect.Ptr:
+		elem := reflect.New(v.Type().Elem())
+		err := setValue(elem.Elem(), vals)
+		if err != nil {
+			return err
+		}
+		v.Set(elem)
+		return nil
+	case reflect.Slice:
+		slice := reflect.MakeSlice(v.Type(), len(vals), len(vals))
+		for i, val := range vals {
+			err := setValue(slice.Index(i), []string{val})
+			if err != nil {
+				return err
+			}
+		}
+		v.Set(slice)
+		return nil
+	}
+
+	val := vals[0]
+	if v.Type() == durationType {
+		d, err := time.ParseDuration(val)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(val)
+	case reflect.Bool:
+		b, err := ParseBool(val)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32,
+		reflect.Int64:
+		i, err := strconv.ParseInt(val, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32,
+		reflect.Uint64:
+		u, err := strconv.ParseUint(val, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(u)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(val, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+	default:
+		return fmt.Errorf("unsupported type %v", v.Type())
+	}
+	return nil
+}
@@ -0,0 +1,112 @@
+// Copyright (C) 2017 JT Olds
+// See LICENSE for copying information
+
+package whparse_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"gopkg.in/webhelp.v1/wherr"
+	"gopkg.in/webhelp.v1/whmux"
+	"gopkg.in/webhelp.v1/whparse"
+)
+
+type listReq struct {
+	UserID  int64         `path:"id"`
+	Limit   int           `query:"limit" default:"20"`
+	Tags    []string      `query:"tag"`
+	Since   time.Time     `query:"since" required:"true"`
+	Timeout time.Duration `query:"timeout"`
+	Verbose *bool         `query:"verbose"`
+	IP      net.IP        `header:"X-Forwarded-For"`
+	Name    string        `form:"name" query:"name"`
+}
+
+func TestBind(t *testing.T) {
+	var req listReq
+	var err error
+	handler := whmux.NewNamedIntArg("id").Shift(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			err = whparse.Bind(r, &req)
+		}))
+
+	r := httptest.NewRequest("POST", "/12?tag=a&tag=b&"+
+		"since=2017-01-02T03:04:05Z&timeout=1m&verbose=yes&name=query",
+		strings.NewReader("name=form"))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	r.Header.Set("X-Forwarded-For", "10.0.0.1")
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if req.UserID != 12 || req.Limit != 20 ||
+		!reflect.DeepEqual(req.Tags, []string{"a", "b"}) ||
+		!req.Since.Equal(time.Date(2017, 1, 2, 3, 4, 5, 0, time.UTC)) ||
+		req.Timeout != time.Minute || req.Verbose == nil || !*req.Verbose ||
+		req.IP.String() != "10.0.0.1" || req.Name != "query" {
+		t.Fatalf("unexpected result: %#v", req)
+	}
+
+	req = listReq{}
+	handler.ServeHTTP(httptest.NewRecorder(),
+		httptest.NewRequest("GET", "/1?limit=many&timeout=soon", nil))
+	if wherr.StatusCode(err) != http.StatusBadRequest {
+		t.Fatalf("expected bad request, got %v", err)
+	}
+	fields := wherr.FieldMap(err)
+	if len(fields) != 3 || fields["limit"][0].Code != "invalid" ||
+		fields["timeout"][0].Code != "invalid" ||
+		fields["since"][0].Code != "required" {
+		t.Fatalf("unexpected field errors: %v", fields)
+	}
+
+	req = listReq{Limit: 5, Since: time.Now()}
+	handler.ServeHTTP(httptest.NewRecorder(),
+		httptest.NewRequest("GET", "/1", nil))
+	if err != nil || req.Limit != 5 {
+		t.Fatalf("prefilled fields shouldn't be overwritten: %v %#v", err, req)
+	}
+}
+
+func TestBindMultipart(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "bind")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	defer os.Setenv("TMPDIR", os.Getenv("TMPDIR"))
+	os.Setenv("TMPDIR", tmp)
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	mw.WriteField("name", "form")
+	fw, err := mw.CreateFormFile("upload", "big.bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// big enough to be spilled to a temporary file.
+	fw.Write(make([]byte, 33<<20))
+	mw.Close()
+
+	r := httptest.NewRequest("POST", "/", &body)
+	r.Header.Set("Content-Type", mw.FormDataContentType())
+	var req struct {
+		Name string `form:"name"`
+	}
+	if err := whparse.Bind(r, &req); err != nil || req.Name != "form" {
+		t.Fatalf("unexpected result: %v %#v", err, req)
+	}
+	if files, _ := ioutil.ReadDir(tmp); len(files) != 0 {
+		t.Fatalf("temporary files left behind: %d", len(files))
+	}
+}
@@ -0,0 +1,731 @@
+// Copyright (C) 2017 JT Olds
+// See LICENSE for copying information
+
+package whparse
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CacheControl is a parsed Cache-Control header (RFC 7234 and RFC 8246).
+// Durations are whole seconds; nil means the directive wasn't given.
+type CacheControl struct {
+	NoCache, NoStore, NoTransform, OnlyIfCached bool
+	MustRevalidate, ProxyRevalidate, Public     bool
+	Private, Immutable                          bool
+	MaxAge, SMaxAge, MinFresh                   *time.Duration
+	StaleWhileRevalidate, StaleIfError          *time.Duration
+
+	// MaxStale is negative for a max-stale directive without a value, which
+	// means any staleness is acceptable.
+	MaxStale *time.Duration
+
+	// NoCacheFields and PrivateFields are the header field names given to
+	// no-cache and private, like `private="Set-Cookie"`.
+	NoCacheFields, PrivateFields []string
+
+	// Extensions holds any other directives, with lowercased names. Values
+	// are empty for directives without one.
+	Extensions map[string]string
+}
+
+// Age returns a pointer to d, for filling in CacheControl durations, like
+// CacheControl{MaxAge: whparse.Age(time.Hour)}.
+func Age(d time.Duration) *time.Duration { return &d }
+
+// ParseCacheControl parses a Cache-Control header. Directive names are
+// case-insensitive. Malformed directives, like a max-age without a
+// non-negative integer value, are errors.
+func ParseCacheControl(header string) (CacheControl, error) {
+	var cc CacheControl
+	s := headerScanner{s: header}
+	for {
+		s.skipSpace()
+		if s.done() {
+			return cc, nil
+		}
+		name := strings.ToLower(s.token())
+		if name == "" {
+			return CacheControl{}, s.errorf("expected a directive")
+		}
+		var val string
+		hasVal := s.consume('=')
+		if hasVal {
+			var err error
+			val, err = s.value()
+			if err != nil {
+				return CacheControl{}, err
+			}
+		}
+		err := cc.set(name, val, hasVal)
+		if err != nil {
+			return CacheControl{}, err
+		}
+		s.skipSpace()
+		if !s.done() && !s.consume(',') {
+			return CacheControl{}, s.errorf(`expected ","`)
+		}
+	}
+}
+
+func (cc *CacheControl) set(name, val string, hasVal bool) error {
+	flags := map[string]*bool{
+		"no-store":         &cc.NoStore,
+		"no-transform":     &cc.NoTransform,
+		"only-if-cached":   &cc.OnlyIfCached,
+		"must-revalidate":  &cc.MustRevalidate,
+		"proxy-revalidate": &cc.ProxyRevalidate,
+		"public":           &cc.Public,
+		"immutable":        &cc.Immutable}
+	durations := map[string]**time.Duration{
+		"max-age":                &cc.MaxAge,
+		"s-maxage":               &cc.SMaxAge,
+		"min-fresh":              &cc.MinFresh,
+		"max-stale":              &cc.MaxStale,
+		"stale-while-revalidate": &cc.StaleWhileRevalidate,
+		"stale-if-error":         &cc.StaleIfError}
+
+	if flag, ok := flags[name]; ok {
+		if hasVal {
+			return fmt.Errorf("cache directive %s doesn't take a value", name)
+		}
+		*flag = true
+		return nil
+	}
+	if dst, ok := durations[name]; ok {
+		if !hasVal && name == "max-stale" {
+			*dst = Age(-1)
+			return nil
+		}
+		secs, err := strconv.ParseInt(val, 10, 64)
+		if err != nil || secs < 0 {
+			return fmt.Errorf("invalid %s value %#v", name, val)
+		}
+		*dst = Age(time.Duration(secs) * time.Second)
+		return nil
+	}
+	switch name {
+	case "no-cache":
+		cc.NoCache = true
+		cc.NoCacheFields = splitFields(val)
+	case "private":
+		cc.Private = true
+		cc.PrivateFields = splitFields(val)
+	default:
+		if cc.Extensions == nil {
+			cc.Extensions = map[string]string{}
+		}
+		cc.Extensions[name] = val
+	}
+	return nil
+}
+
+func splitFields(val string) (fields []string) {
+	for _, field := range strings.Split(val, ",") {
+		if field = strings.TrimSpace(field); field != "" {
+			fields = append(fields, field)
+		}
+	}
+	return fields
+}
+
+// String formats cc as a Cache-Control header value.
+func (cc CacheControl) String() string {
+	var parts []string
+	fieldList := func(name string, fields []string) {
+		if len(fields) == 0 {
+			parts = append(parts, name)
+		} else {
+			parts = append(parts,
+				name+"="+quoteString(strings.Join(fields, ", ")))
+		}
+	}
+	if cc.Public {
+		parts = append(parts, "public")
+	}
+	if cc.Private {
+		fieldList("private", cc.PrivateFields)
+	}
+	if cc.NoCache {
+		fieldList("no-cache", cc.NoCacheFields)
+	}
+	for _, flag := range []struct {
+		name string
+		set  bool
+	}{
+		{"no-store", cc.NoStore}, {"no-transform", cc.NoTransform},
+		{"only-if-cached", cc.OnlyIfCached},
+		{"must-revalidate", cc.MustRevalidate},
+		{"proxy-revalidate", cc.ProxyRevalidate},
+		{"immutable", cc.Immutable}} {
+		if flag.set {
+			parts = append(parts, flag.name)
+		}
+	}
+	for _, d := range []struct {
+		name string
+		val  *time.Duration
+	}{
+		{"max-age", cc.MaxAge}, {"s-maxage", cc.SMaxAge},
+		{"max-stale", cc.MaxStale}, {"min-fresh", cc.MinFresh},
+		{"stale-while-revalidate", cc.StaleWhileRevalidate},
+		{"stale-if-error", cc.StaleIfError}} {
+		switch {
+		case d.val == nil:
+		case *d.val < 0:
+			parts = append(parts, d.name)
+		default:
+			parts = append(parts,
+				fmt.Sprintf("%s=%d", d.name, int64(*d.val/time.Second)))
+		}
+	}
+	parts = append(parts, formatParams(cc.Extensions, bareParams)...)
+	return strings.Join(parts, ", ")
+}
+
+// ByteRange is one range of a Range header. Start and End are inclusive
+// byte positions. End is -1 for an open-ended range like "500-". For a
+// suffix range like "-500", which asks for the last 500 bytes, Start is -1
+// and End is the suffix length.
+type ByteRange struct {
+	Start, End int64
+}
+
+// Resolve returns the offset and length of the range within content of the
+// given size, or false if the range can't be satisfied.
+func (br ByteRange) Resolve(size int64) (offset, length int64, ok bool) {
+	if br.Start < 0 {
+		if br.End <= 0 || size <= 0 {
+			return 0, 0, false
+		}
+		if br.End > size {
+			return 0, size, true
+		}
+		return size - br.End, br.End, true
+	}
+	if br.Start >= size {
+		return 0, 0, false
+	}
+	end := br.End
+	if end < 0 || end >= size {
+		end = size - 1
+	}
+	return br.Start, end - br.Start + 1, true
+}
+
+func (br ByteRange) String() string {
+	switch {
+	case br.Start < 0:
+		return fmt.Sprintf("-%d", br.End)
+	case br.End < 0:
+		return fmt.Sprintf("%d-", br.Start)
+	}
+	return fmt.Sprintf("%d-%d", br.Start, br.End)
+}
+
+// ParseByteRanges parses a Range header like "bytes=0-499,1000-". Units
+// other than bytes, ranges that end before they start, and malformed
+// ranges are errors.
+func ParseByteRanges(header string) ([]ByteRange, error) {
+	header = strings.TrimSpace(header)
+	if !strings.HasPrefix(strings.ToLower(header), "bytes=") {
+		return nil, fmt.Errorf("invalid range %#v, expected bytes", header)
+	}
+	var ranges []ByteRange
+	for _, spec := range strings.Split(header[len("bytes="):], ",") {
+		spec = strings.TrimSpace(spec)
+		if spec == "" {
+			continue
+		}
+		br, err := parseByteRange(spec)
+		if err != nil {
+			return nil, err
+		}
+		ranges = append(ranges, br)
+	}
+	if len(ranges) == 0 {
+		return nil, fmt.Errorf("invalid range %#v, no ranges", header)
+	}
+	return ranges, nil
+}
+
+func parseByteRange(spec string) (ByteRange, error) {
+	dash := strings.IndexByte(spec, '-')
+	if dash < 0 {
+		return ByteRange{}, fmt.Errorf("invalid byte range %#v", spec)
+	}
+	first, last := spec[:dash], spec[dash+1:]
+	num := func(val string) (int64, bool) {
+		n, err := strconv.ParseInt(val, 10, 64)
+		return n, err == nil && n >= 0 && !strings.HasPrefix(val, "+")
+	}
+	if first == "" {
+		n, ok := num(last)
+		if !ok {
+			return ByteRange{}, fmt.Errorf("invalid byte range %#v", spec)
+		}
+		return ByteRange{Start: -1, End: n}, nil
+	}
+	start, ok := num(first)
+	if !ok {
+		return ByteRange{}, fmt.Errorf("invalid byte range %#v", spec)
+	}
+	if last == "" {
+		return ByteRange{Start: start, End: -1}, nil
+	}
+	end, ok := num(last)
+	if !ok || end < start {
+		return ByteRange{}, fmt.Errorf("invalid byte range %#v", spec)
+	}
+	return ByteRange{Start: start, End: end}, nil
+}
+
+// FormatByteRanges formats ranges as a Range header value, like
+// "bytes=0-499,1000-".
+func FormatByteRanges(ranges ...ByteRange) string {
+	specs := make([]string, 0, len(ranges))
+	for _, br := range ranges {
+		specs = append(specs, br.String())
+	}
+	return "bytes=" + strings.Join(specs, ",")
+}
+
+// ContentRange is a parsed Content-Range header, the response counterpart
+// of ByteRange. Start and End are inclusive byte positions, and Size is the
+// complete length, or -1 if unknown. For an unsatisfied range response, like
+// "bytes */1000", Start and End are -1.
+type ContentRange struct {
+	Start, End, Size int64
+}
+
+// ParseContentRange parses a Content-Range header like "bytes 0-499/1234".
+func ParseContentRange(header string) (ContentRange, error) {
+	invalid := fmt.Errorf("invalid content range %#v", header)
+	val := strings.TrimSpace(header)
+	if !strings.HasPrefix(strings.ToLower(val), "bytes ") {
+		return ContentRange{}, invalid
+	}
+	parts := strings.SplitN(strings.TrimSpace(val[len("bytes "):]), "/", 2)
+	if len(parts) != 2 {
+		return ContentRange{}, invalid
+	}
+	cr := ContentRange{Start: -1, End: -1, Size: -1}
+	if parts[1] != "*" {
+		size, err := strconv.ParseInt(parts[1], 10, 64)
+		if err != nil || size < 0 {
+			return ContentRange{}, invalid
+		}
+		cr.Size = size
+	}
+	if parts[0] == "*" {
+		if cr.Size < 0 {
+			return ContentRange{}, invalid
+		}
+		return cr, nil
+	}
+	br, err := parseByteRange(parts[0])
+	if err != nil || br.Start < 0 || br.End < 0 ||
+		(cr.Size >= 0 && br.End >= cr.Size) {
+		return ContentRange{}, invalid
+	}
+	cr.Start, cr.End = br.Start, br.End
+	return cr, nil
+}
+
+func (cr ContentRange) String() string {
+	size := "*"
+	if cr.Size >= 0 {
+		size = strconv.FormatInt(cr.Size, 10)
+	}
+	if cr.Start < 0 {
+		return "bytes */" + size
+	}
+	return fmt.Sprintf("bytes %d-%d/%s", cr.Start, cr.End, size)
+}
+
+// Forwarded is one element of a Forwarded header (RFC 7239), describing one
+// proxy hop.
+type Forwarded struct {
+	// For and By are the client and proxy node identifiers, like
+	// "192.0.2.60", "[2001:db8::1]:4711", or "unknown". Host is the original
+	// Host header and Proto the original scheme.
+	For, By, Host, Proto string
+
+	// Extensions holds any other parameters, with lowercased names.
+	Extensions map[string]string
+}
+
+// ParseForwarded parses a Forwarded header into its elements, with the
+// element added by the proxy nearest the client first. If a request has
+// multiple Forwarded headers, join them with commas first.
+func ParseForwarded(header string) ([]Forwarded, error) {
+	var elems []Forwarded
+	s := headerScanner{s: header}
+	for {
+		s.skipSpace()
+		if s.done() {
+			return elems, nil
+		}
+		var elem Forwarded
+		for {
+			s.skipSpace()
+			name := strings.ToLower(s.token())
+			if name == "" || !s.consume('=') {
+				return nil, s.errorf("expected a forwarded pair")
+			}
+			val, err := s.value()
+			if err != nil {
+				return nil, err
+			}
+			switch name {
+			case "for":
+				elem.For = val
+			case "by":
+				elem.By = val
+			case "host":
+				elem.Host = val
+			case "proto":
+				elem.Proto = strings.ToLower(val)
+			default:
+				if elem.Extensions == nil {
+					elem.Extensions = map[string]string{}
+				}
+				elem.Extensions[name] = val
+			}
+			s.skipSpace()
+			if !s.consume(';') {
+				break
+			}
+		}
+		elems = append(elems, elem)
+		if !s.done() && !s.consume(',') {
+			return nil, s.errorf(`expected "," or ";"`)
+		}
+	}
+}
+
+// FormatForwarded formats elems as a Forwarded header value, quoting values
+// that need it, like IPv6 addresses.
+func FormatForwarded(elems ...Forwarded) string {
+	formatted := make([]string, 0, len(elems))
+	for _, elem := range elems {
+		var pairs []string
+		for _, pair := range []struct{ name, val string }{
+			{"for", elem.For}, {"by", elem.By}, {"host", elem.Host},
+			{"proto", elem.Proto}} {
+			if pair.val != "" {
+				pairs = append(pairs, pair.name+"="+quoteIfNeeded(pair.val))
+			}
+		}
+		pairs = append(pairs, formatParams(elem.Extensions, pairParams)...)
+		formatted = append(formatted, strings.Join(pairs, ";"))
+	}
+	return strings.Join(formatted, ", ")
+}
+
+// Link is one link of a Link header (RFC 8288).
+type Link struct {
+	URL string
+
+	// Rel is the relation type, like "next". Multiple relation types are
+	// separated by spaces.
+	Rel string
+
+	// Params holds any other parameters, like title, with lowercased names.
+	Params map[string]string
+}
+
+// ParseLinks parses a Link header into its links.
+func ParseLinks(header string) ([]Link, error) {
+	var links []Link
+	s := headerScanner{s: header}
+	for {
+		s.skipSpace()
+		if s.done() {
+			return links, nil
+		}
+		if !s.consume('<') {
+			return nil, s.errorf(`expected "<"`)
+		}
+		end := strings.IndexByte(s.s[s.pos:], '>')
+		if end < 0 {
+			return nil, s.errorf(`expected ">"`)
+		}
+		link := Link{URL: strings.TrimSpace(s.s[s.pos : s.pos+end])}
+		s.pos += end + 1
+		params, err := s.params()
+		if err != nil {
+			return nil, err
+		}
+		if rel, ok := params["rel"]; ok {
+			link.Rel = rel
+			delete(params, "rel")
+		}
+		if len(params) > 0 {
+			link.Params = params
+		}
+		links = append(links, link)
+		s.skipSpace()
+		if !s.done() && !s.consume(',') {
+			return nil, s.errorf(`expected ","`)
+		}
+	}
+}
+
+// FormatLinks formats links as a Link header value, like
+// `</items?offset=40>; rel="next"`.
+func FormatLinks(links ...Link) string {
+	formatted := make([]string, 0, len(links))
+	for _, link := range links {
+		parts := []string{"<" + link.URL + ">"}
+		if link.Rel != "" {
+			parts = append(parts, "rel="+quoteString(link.Rel))
+		}
+		parts = append(parts, formatParams(link.Params, quotedParams)...)
+		formatted = append(formatted, strings.Join(parts, "; "))
+	}
+	return strings.Join(formatted, ", ")
+}
+
+// Prefer is one preference of a Prefer header (RFC 7240), like
+// "return=minimal" or "respond-async". The same structure describes the
+// Preference-Applied response header, which doesn't use Params.
+type Prefer struct {
+	// Name is lowercased.
+	Name, Value string
+
+	// Params holds any parameters after the preference, with lowercased
+	// names.
+	Params map[string]string
+}
+
+// ParsePrefer parses a Prefer or Preference-Applied header into its
+// preferences. If a request has multiple Prefer headers, join them with
+// commas first.
+func ParsePrefer(header string) ([]Prefer, error) {
+	var prefs []Prefer
+	s := headerScanner{s: header}
+	for {
+		s.skipSpace()
+		if s.done() {
+			return prefs, nil
+		}
+		pref := Prefer{Name: strings.ToLower(s.token())}
+		if pref.Name == "" {
+			return nil, s.errorf("expected a preference")
+		}
+		s.skipSpace()
+		if s.consume('=') {
+			s.skipSpace()
+			val, err := s.value()
+			if err != nil {
+				return nil, err
+			}
+			pref.Value = val
+		}
+		params, err := s.params()
+		if err != nil {
+			return nil, err
+		}
+		if len(params) > 0 {
+			pref.Params = params
+		}
+		prefs = append(prefs, pref)
+		s.skipSpace()
+		if !s.done() && !s.consume(',') {
+			return nil, s.errorf(`expected ","`)
+		}
+	}
+}
+
+// FindPrefer returns the first preference in prefs with the given name, or
+// false if there isn't one.
+func FindPrefer(prefs []Prefer, name string) (Prefer, bool) {
+	for _, pref := range prefs {
+		if strings.EqualFold(pref.Name, name) {
+			return pref, true
+		}
+	}
+	return Prefer{}, false
+}
+
+// FormatPrefer formats prefs as a Prefer or Preference-Applied header value,
+// like "return=minimal, wait=10".
+func FormatPrefer(prefs ...Prefer) string {
+	formatted := make([]string, 0, len(prefs))
+	for _, pref := range prefs {
+		part := pref.Name
+		if pref.Value != "" {
+			part += "=" + quoteIfNeeded(pref.Value)
+		}
+		parts := append([]string{part}, formatParams(pref.Params, bareParams)...)
+		formatted = append(formatted, strings.Join(parts, "; "))
+	}
+	return strings.Join(formatted, ", ")
+}
+
+// paramStyle says how formatParams writes parameter values.
+type paramStyle int
+
+const (
+	// bareParams quotes values only if needed, and writes parameters with
+	// empty values as just their name.
+	bareParams paramStyle = iota
+	// quotedParams is like bareParams, but always quotes other values.
+	quotedParams
+	// pairParams quotes values only if needed, and always writes name=value,
+	// for headers like Forwarded that don't allow bare names.
+	pairParams
+)
+
+// formatParams formats params as name=value pairs sorted by name, so output
+// is deterministic.
+func formatParams(params map[string]string, style paramStyle) []string {
+	names := make([]string, 0, len(params))
+	for name := range params {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	formatted := make([]string, 0, len(names))
+	for _, name := range names {
+		val := params[name]
+		switch {
+		case val == "" && style != pairParams:
+			formatted = append(formatted, name)
+		case style == quotedParams:
+			formatted = append(formatted, name+"="+quoteString(val))
+		default:
+			formatted = append(formatted, name+"="+quoteIfNeeded(val))
+		}
+	}
+	return formatted
+}
+
+func isTokenChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' ||
+		c >= '0' && c <= '9' || strings.IndexByte("!#$%&'*+-.^_`|~", c) >= 0
+}
+
+func quoteIfNeeded(val string) string {
+	for i := 0; i < len(val); i++ {
+		if !isTokenChar(val[i]) {
+			return quoteString(val)
+		}
+	}
+	if val == "" {
+		return `""`
+	}
+	return val
+}
+
+// quoteString returns val as an RFC 7230 quoted-string, which only escapes
+// double quotes and backslashes, unlike strconv.Quote.
+func quoteString(val string) string {
+	quoted := make([]byte, 0, len(val)+2)
+	quoted = append(quoted, '"')
+	for i := 0; i < len(val); i++ {
+		if val[i] == '"' || val[i] == '\\' {
+			quoted = append(quoted, '\\')
+		}
+		quoted = append(quoted, val[i])
+	}
+	return string(append(quoted, '"'))
+}
+
+// headerScanner tokenizes the comma, semicolon, and equals sign separated
+// structure most HTTP headers share.
+type headerScanner struct {
+	s   string
+	pos int
+}
+
+func (s *headerScanner) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("invalid header %#v at position %d: %s", s.s, s.pos,
+		fmt.Sprintf(format, args...))
+}
+
+func (s *headerScanner) done() bool { return s.pos >= len(s.s) }
+
+func (s *headerScanner) skipSpace() {
+	for !s.done() && (s.s[s.pos] == ' ' || s.s[s.pos] == '\t') {
+		s.pos++
+	}
+}
+
+func (s *headerScanner) consume(c byte) bool {
+	if !s.done() && s.s[s.pos] == c {
+		s.pos++
+		return true
+	}
+	return false
+}
+
+func (s *headerScanner) token() string {
+	start := s.pos
+	for !s.done() && isTokenChar(s.s[s.pos]) {
+		s.pos++
+	}
+	return s.s[start:s.pos]
+}
+
+// value reads a token or a quoted string, unescaping the latter.
+func (s *headerScanner) value() (string, error) {
+	if !s.consume('"') {
+		tok := s.token()
+		if tok == "" {
+			return "", s.errorf("expected a value")
+		}
+		return tok, nil
+	}
+	var val []byte
+	for !s.done() {
+		c := s.s[s.pos]
+		s.pos++
+		switch c {
+		case '"':
+			return string(val), nil
+		case '\\':
+			if s.done() {
+				return "", s.errorf("unterminated quoted string")
+			}
+			c = s.s[s.pos]
+			s.pos++
+		}
+		val = append(val, c)
+	}
+	return "", s.errorf("unterminated quoted string")
+}
+
+// params reads any number of `; name=value` parameters, where the value is
+// optional.
+func (s *headerScanner) params() (map[string]string, error) {
+	params := map[string]string{}
+	for {
+		s.skipSpace()
+		if !s.consume(';') {
+			return params, nil
+		}
+		s.skipSpace()
+		name := strings.ToLower(s.token())
+		if name == "" {
+			return nil, s.errorf("expected a parameter name")
+		}
+		s.skipSpace()
+		var val string
+		if s.consume('=') {
+			s.skipSpace()
+			var err error
+			val, err = s.value()
+			if err != nil {
+				return nil, err
+			}
+		}
+		if _, exists := params[name]; !exists {
+			params[name] = val
+		}
+	}
+}
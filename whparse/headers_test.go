@@ -0,0 +1,194 @@
+// Copyright (C) 2017 JT Olds
+// See LICENSE for copying information
+
+package whparse_test
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"gopkg.in/webhelp.v1/whparse"
+)
+
+func TestCacheControl(t *testing.T) {
+	cc, err := whparse.ParseCacheControl(
+		`Max-Age=60, no-cache, private="Set-Cookie, X-Token", max-stale, ` +
+			`community="UCI"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cc.MaxAge == nil || *cc.MaxAge != time.Minute || !cc.NoCache ||
+		!cc.Private || cc.MaxStale == nil || *cc.MaxStale >= 0 ||
+		!reflect.DeepEqual(cc.PrivateFields, []string{"Set-Cookie", "X-Token"}) ||
+		cc.Extensions["community"] != "UCI" {
+		t.Fatalf("unexpected cache control: %#v", cc)
+	}
+	if s := cc.String(); s != `private="Set-Cookie, X-Token", no-cache, `+
+		`max-age=60, max-stale, community=UCI` {
+		t.Fatalf("unexpected format: %s", s)
+	}
+	if s := (whparse.CacheControl{Public: true,
+		MaxAge: whparse.Age(0)}).String(); s != "public, max-age=0" {
+		t.Fatalf("unexpected format: %s", s)
+	}
+	for _, header := range []string{"max-age=-1", "max-age", "public=1",
+		`no-cache="x`, "max-age=1 public", ","} {
+		if _, err := whparse.ParseCacheControl(header); err == nil {
+			t.Fatalf("expected error for %#v", header)
+		}
+	}
+}
+
+func TestByteRanges(t *testing.T) {
+	ranges, err := whparse.ParseByteRanges("bytes=0-499, 1000-, -200")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(ranges, []whparse.ByteRange{
+		{Start: 0, End: 499}, {Start: 1000, End: -1}, {Start: -1, End: 200}}) {
+		t.Fatalf("unexpected ranges: %v", ranges)
+	}
+	if s := whparse.FormatByteRanges(ranges...); s != "bytes=0-499,1000-,-200" {
+		t.Fatalf("unexpected format: %s", s)
+	}
+	for _, test := range []struct {
+		br             whparse.ByteRange
+		offset, length int64
+		ok             bool
+	}{
+		{ranges[0], 0, 500, true},
+		{ranges[1], 1000, 200, true},
+		{ranges[2], 1000, 200, true},
+		{whparse.ByteRange{Start: 1200, End: 1300}, 0, 0, false},
+		{whparse.ByteRange{Start: -1, End: 5000}, 0, 1200, true},
+	} {
+		offset, length, ok := test.br.Resolve(1200)
+		if offset != test.offset || length != test.length || ok != test.ok {
+			t.Fatalf("%v: unexpected %d %d %v", test.br, offset, length, ok)
+		}
+	}
+	for _, header := range []string{"items=0-1", "bytes=", "bytes=5-1",
+		"bytes=a-b", "bytes=-", "bytes=+1-2"} {
+		if _, err := whparse.ParseByteRanges(header); err == nil {
+			t.Fatalf("expected error for %#v", header)
+		}
+	}
+
+	cr, err := whparse.ParseContentRange("bytes 0-499/1234")
+	if err != nil || cr != (whparse.ContentRange{0, 499, 1234}) {
+		t.Fatalf("unexpected content range %v: %v", cr, err)
+	}
+	for _, cr := range []whparse.ContentRange{
+		{0, 499, 1234}, {0, 499, -1}, {-1, -1, 1234}} {
+		parsed, err := whparse.ParseContentRange(cr.String())
+		if err != nil || parsed != cr {
+			t.Fatalf("%v: round trip gave %v: %v", cr, parsed, err)
+		}
+	}
+	if _, err := whparse.ParseContentRange("bytes 0-5000/1234"); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestForwarded(t *testing.T) {
+	elems, err := whparse.ParseForwarded(
+		`for=192.0.2.60;proto=HTTP;by=203.0.113.43, ` +
+			`For="[2001:db8:cafe::17]:4711";secret="x y"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(elems, []whparse.Forwarded{
+		{For: "192.0.2.60", By: "203.0.113.43", Proto: "http"},
+		{For: "[2001:db8:cafe::17]:4711",
+			Extensions: map[string]string{"secret": "x y"}}}) {
+		t.Fatalf("unexpected elements: %#v", elems)
+	}
+	if s := whparse.FormatForwarded(elems...); s != `for=192.0.2.60;`+
+		`by=203.0.113.43;proto=http, for="[2001:db8:cafe::17]:4711";`+
+		`secret="x y"` {
+		t.Fatalf("unexpected format: %s", s)
+	}
+	// Forwarded has no bare names, so empty values have to be quoted.
+	elems, err = whparse.ParseForwarded(`for=1.2.3.4;secret=""`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := whparse.FormatForwarded(elems...)
+	if s != `for=1.2.3.4;secret=""` {
+		t.Fatalf("unexpected format: %s", s)
+	}
+	if again, err := whparse.ParseForwarded(s); err != nil ||
+		!reflect.DeepEqual(again, elems) {
+		t.Fatalf("unexpected round trip: %#v %v", again, err)
+	}
+
+	for _, header := range []string{"for", "for=", `for="x`, "for=a b"} {
+		if _, err := whparse.ParseForwarded(header); err == nil {
+			t.Fatalf("expected error for %#v", header)
+		}
+	}
+}
+
+func TestLinks(t *testing.T) {
+	links, err := whparse.ParseLinks(`</items?a=1,2>; rel="next"; ` +
+		`title="Next, please", <https://example.com/>;REL=prev`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(links, []whparse.Link{
+		{URL: "/items?a=1,2", Rel: "next",
+			Params: map[string]string{"title": "Next, please"}},
+		{URL: "https://example.com/", Rel: "prev"}}) {
+		t.Fatalf("unexpected links: %#v", links)
+	}
+	if s := whparse.FormatLinks(links...); s != `</items?a=1,2>; rel="next"; `+
+		`title="Next, please", <https://example.com/>; rel="prev"` {
+		t.Fatalf("unexpected format: %s", s)
+	}
+	for _, header := range []string{"/items", "</items", "<a> rel=next",
+		"<a>; =x"} {
+		if _, err := whparse.ParseLinks(header); err == nil {
+			t.Fatalf("expected error for %#v", header)
+		}
+	}
+}
+
+func TestPrefer(t *testing.T) {
+	prefs, err := whparse.ParsePrefer(
+		`respond-async, Wait=100, return="minimal"; foo=bar; baz`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(prefs, []whparse.Prefer{
+		{Name: "respond-async"}, {Name: "wait", Value: "100"},
+		{Name: "return", Value: "minimal",
+			Params: map[string]string{"foo": "bar", "baz": ""}}}) {
+		t.Fatalf("unexpected preferences: %#v", prefs)
+	}
+	if pref, ok := whparse.FindPrefer(prefs, "RETURN"); !ok ||
+		pref.Value != "minimal" {
+		t.Fatalf("unexpected preference: %#v", pref)
+	}
+	if s := whparse.FormatPrefer(prefs...); s != `respond-async, wait=100, `+
+		`return=minimal; baz; foo=bar` {
+		t.Fatalf("unexpected format: %s", s)
+	}
+	if _, err := whparse.ParsePrefer("return=minimal handling"); err == nil {
+		t.Fatal("expected error")
+	}
+
+	// quoted values round trip, escaping only quotes and backslashes.
+	quoted := whparse.Prefer{Name: "note", Value: "a\tb \"c\" \\ é"}
+	s := whparse.FormatPrefer(quoted)
+	if s != "note=\"a\tb \\\"c\\\" \\\\ é\"" {
+		t.Fatalf("unexpected format: %s", s)
+	}
+	prefs, err = whparse.ParsePrefer(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(prefs) != 1 || prefs[0].Value != quoted.Value {
+		t.Fatalf("unexpected round trip: %#v", prefs)
+	}
+}
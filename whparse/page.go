@@ -0,0 +1,230 @@
+// Copyright (C) 2017 JT Olds
+// See LICENSE for copying information
+
+package whparse
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"gopkg.in/webhelp.v1/wherr"
+)
+
+// fallbackPageSize is the page size when a Paginator has neither a
+// DefaultSize nor a MaxSize.
+const fallbackPageSize = 20
+
+var (
+	// DefaultPaginator is a Paginator with a default page size of 20 and a
+	// maximum of 100, and no cursor support.
+	DefaultPaginator = &Paginator{DefaultSize: 20, MaxSize: 100}
+)
+
+// Page is a requested page of results.
+type Page struct {
+	// Size is the number of results to return.
+	Size int
+
+	// Offset is the number of results to skip. It's always zero if Cursor is
+	// set.
+	Offset int64
+
+	// Cursor is the verified value passed to Paginator.CursorURL for the
+	// previous page, or empty for the first page.
+	Cursor string
+}
+
+// Paginator parses and generates pagination query parameters. Pages can be
+// picked by offset, or by opaque cursor tokens, which are signed so clients
+// can only use cursors the server handed out.
+type Paginator struct {
+	// DefaultSize is the page size if none is given. If it's zero, pages
+	// default to MaxSize, or to 20 if MaxSize is zero too. MaxSize is the
+	// largest page size clients may ask for. Zero means no limit.
+	DefaultSize, MaxSize int
+
+	// SizeParam, OffsetParam, and CursorParam name the query parameters.
+	// They default to "limit", "offset", and "cursor".
+	SizeParam, OffsetParam, CursorParam string
+
+	// Secret is the HMAC key cursors are signed with. Cursors are rejected if
+	// it is empty, and EncodeCursor and CursorURL panic.
+	Secret []byte
+}
+
+func (p *Paginator) sizeParam() string {
+	if p.SizeParam == "" {
+		return "limit"
+	}
+	return p.SizeParam
+}
+
+func (p *Paginator) defaultSize() int {
+	switch {
+	case p.DefaultSize > 0:
+		return p.DefaultSize
+	case p.MaxSize > 0:
+		return p.MaxSize
+	}
+	return fallbackPageSize
+}
+
+func (p *Paginator) offsetParam() string {
+	if p.OffsetParam == "" {
+		return "offset"
+	}
+	return p.OffsetParam
+}
+
+func (p *Paginator) cursorParam() string {
+	if p.CursorParam == "" {
+		return "cursor"
+	}
+	return p.CursorParam
+}
+
+// ParsePage parses r's pagination parameters with DefaultPaginator.
+func ParsePage(r *http.Request) (Page, error) {
+	return DefaultPaginator.Parse(r)
+}
+
+// Parse returns the Page r asks for. Page sizes that aren't positive or are
+// larger than MaxSize, negative offsets, forged cursors, and giving both an
+// offset and a cursor are all reported as wherr.BadRequest errors.
+func (p *Paginator) Parse(r *http.Request) (Page, error) {
+	vals := r.URL.Query()
+	page := Page{}
+	size, err := Int(vals, p.sizeParam(), p.defaultSize())
+	if err != nil {
+		return Page{}, err
+	}
+	if size <= 0 || (p.MaxSize > 0 && size > p.MaxSize) {
+		expected := "a positive page size"
+		if p.MaxSize > 0 {
+			expected = fmt.Sprintf("a page size between 1 and %d", p.MaxSize)
+		}
+		return Page{}, invalidParam(p.sizeParam(), vals.Get(p.sizeParam()),
+			expected)
+	}
+	page.Size = size
+
+	page.Offset, err = Int64(vals, p.offsetParam(), 0)
+	if err != nil {
+		return Page{}, err
+	}
+	if page.Offset < 0 {
+		return Page{}, invalidParam(p.offsetParam(),
+			vals.Get(p.offsetParam()), "a non-negative offset")
+	}
+
+	if token := vals.Get(p.cursorParam()); token != "" {
+		if page.Offset != 0 {
+			return Page{}, wherr.BadRequest.New(
+				"can't use both %s and %s", p.offsetParam(), p.cursorParam())
+		}
+		page.Cursor, err = p.DecodeCursor(token)
+		if err != nil {
+			return Page{}, invalidParam(p.cursorParam(), token,
+				"a cursor from a previous response")
+		}
+	}
+	return page, nil
+}
+
+// MustParse is like Parse but panics with the error.
+func (p *Paginator) MustParse(r *http.Request) Page {
+	page, err := p.Parse(r)
+	must(err)
+	return page
+}
+
+func (p *Paginator) sign(data []byte) []byte {
+	mac := hmac.New(sha256.New, p.Secret)
+	mac.Write(data)
+	return mac.Sum(nil)[:16]
+}
+
+// EncodeCursor returns a signed token for value that DecodeCursor will
+// accept. value isn't encrypted, so it shouldn't contain secrets.
+// EncodeCursor panics if Secret is empty, since DecodeCursor would reject
+// every token.
+func (p *Paginator) EncodeCursor(value string) string {
+	if len(p.Secret) == 0 {
+		panic("whparse: Paginator.EncodeCursor needs a Secret")
+	}
+	return base64.RawURLEncoding.EncodeToString([]byte(value)) + "." +
+		base64.RawURLEncoding.EncodeToString(p.sign([]byte(value)))
+}
+
+// DecodeCursor verifies a token made by EncodeCursor and returns its value.
+func (p *Paginator) DecodeCursor(token string) (string, error) {
+	if len(p.Secret) == 0 {
+		return "", fmt.Errorf("cursors not supported")
+	}
+	parts := strings.SplitN(token, ".", 2)
+	if len(parts) != 2 {
+		return "", fmt.Errorf("malformed cursor")
+	}
+	value, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return "", fmt.Errorf("malformed cursor")
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil || !hmac.Equal(sig, p.sign(value)) {
+		return "", fmt.Errorf("invalid cursor signature")
+	}
+	return string(value), nil
+}
+
+// OffsetURL returns r's path and query with the offset parameter set to
+// offset (or removed, if offset is zero) and any cursor removed, for linking
+// to other pages.
+func (p *Paginator) OffsetURL(r *http.Request, offset int64) string {
+	vals := r.URL.Query()
+	vals.Del(p.cursorParam())
+	if offset > 0 {
+		vals.Set(p.offsetParam(), strconv.FormatInt(offset, 10))
+	} else {
+		vals.Del(p.offsetParam())
+	}
+	return withQuery(r, vals.Encode())
+}
+
+// CursorURL returns r's path and query with the cursor parameter set to a
+// signed token for cursor and any offset removed, for linking to other
+// pages. Like EncodeCursor, it panics if Secret is empty.
+func (p *Paginator) CursorURL(r *http.Request, cursor string) string {
+	vals := r.URL.Query()
+	vals.Del(p.offsetParam())
+	vals.Set(p.cursorParam(), p.EncodeCursor(cursor))
+	return withQuery(r, vals.Encode())
+}
+
+// NextOffsetURL returns OffsetURL for the page after page.
+func (p *Paginator) NextOffsetURL(r *http.Request, page Page) string {
+	return p.OffsetURL(r, page.Offset+int64(page.Size))
+}
+
+// PrevOffsetURL returns OffsetURL for the page before page, or the empty
+// string if page is the first page.
+func (p *Paginator) PrevOffsetURL(r *http.Request, page Page) string {
+	if page.Offset <= 0 {
+		return ""
+	}
+	prev := page.Offset - int64(page.Size)
+	if prev < 0 {
+		prev = 0
+	}
+	return p.OffsetURL(r, prev)
+}
+
+func withQuery(r *http.Request, query string) string {
+	u := *r.URL
+	u.RawQuery = query
+	return u.RequestURI()
+}
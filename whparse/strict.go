@@ -0,0 +1,357 @@
+// Copyright (C) 2017 JT Olds
+// See LICENSE for copying information
+
+package whparse
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+
+	"gopkg.in/webhelp.v1/wherr"
+)
+
+// The strict parsers in this file are like their Opt counterparts, but take
+// url.Values (such as http.Request.URL.Query() or http.Request.Form) and a
+// parameter name, and return a wherr.BadRequest error naming the parameter
+// instead of silently falling back to the default when a value fails to
+// parse. The errors carry a wherr.FieldError for the parameter, with code
+// "invalid" or "required".
+//
+// Required variants return an error if the parameter is missing or empty.
+// Must variants panic with the error instead of returning it, and are meant
+// to be used with whfatal.Catch, which will hand the error to wherr.Handle.
+
+// param returns the value of the parameter name, and ok = false if it's
+// missing or empty. It's an error for a missing parameter to be required.
+func param(vals url.Values, name string, required bool) (
+	val string, ok bool, err error) {
+	val = vals.Get(name)
+	if val != "" {
+		return val, true, nil
+	}
+	if required {
+		return "", false, wherr.NewValidationError(wherr.BadRequest,
+			wherr.FieldError{
+				Field:   name,
+				Code:    "required",
+				Message: fmt.Sprintf("missing required parameter %#v", name)})
+	}
+	return "", false, nil
+}
+
+// invalidParam returns the error for a parameter with a value that isn't
+// what was expected.
+func invalidParam(name, val, expected string) error {
+	return wherr.NewValidationError(wherr.BadRequest, wherr.FieldError{
+		Field: name,
+		Code:  "invalid",
+		Message: fmt.Sprintf("invalid value %#v for parameter %#v, expected %s",
+			val, name, expected)})
+}
+
+func must(err error) {
+	if err != nil {
+		panic(err)
+	}
+}
+
+func parseInt(vals url.Values, name string, required bool, def int64,
+	bits int) (int64, error) {
+	val, ok, err := param(vals, name, required)
+	if !ok {
+		return def, err
+	}
+	rv, err := strconv.ParseInt(val, 10, bits)
+	if err != nil {
+		return def, invalidParam(name, val, "an integer")
+	}
+	return rv, nil
+}
+
+func parseUint(vals url.Values, name string, required bool, def uint64,
+	bits int) (uint64, error) {
+	val, ok, err := param(vals, name, required)
+	if !ok {
+		return def, err
+	}
+	rv, err := strconv.ParseUint(val, 10, bits)
+	if err != nil {
+		return def, invalidParam(name, val, "a non-negative integer")
+	}
+	return rv, nil
+}
+
+func parseFloat(vals url.Values, name string, required bool, def float64,
+	bits int) (float64, error) {
+	val, ok, err := param(vals, name, required)
+	if !ok {
+		return def, err
+	}
+	rv, err := strconv.ParseFloat(val, bits)
+	if err != nil {
+		return def, invalidParam(name, val, "a number")
+	}
+	return rv, nil
+}
+
+// Int64 parses the parameter name in vals as an integer, returning def if it's
+// missing.
+func Int64(vals url.Values, name string, def int64) (int64, error) {
+	return parseInt(vals, name, false, def, 64)
+}
+
+// RequiredInt64 is like Int64 but the parameter must be given.
+func RequiredInt64(vals url.Values, name string) (int64, error) {
+	return parseInt(vals, name, true, 0, 64)
+}
+
+// MustInt64 is like Int64 but panics with the error.
+func MustInt64(vals url.Values, name string, def int64) int64 {
+	rv, err := Int64(vals, name, def)
+	must(err)
+	return rv
+}
+
+// MustRequiredInt64 is like RequiredInt64 but panics with the error.
+func MustRequiredInt64(vals url.Values, name string) int64 {
+	rv, err := RequiredInt64(vals, name)
+	must(err)
+	return rv
+}
+
+// Uint64 parses the parameter name in vals as a non-negative integer, returning
+// def if it's missing.
+func Uint64(vals url.Values, name string, def uint64) (uint64, error) {
+	return parseUint(vals, name, false, def, 64)
+}
+
+// RequiredUint64 is like Uint64 but the parameter must be given.
+func RequiredUint64(vals url.Values, name string) (uint64, error) {
+	return parseUint(vals, name, true, 0, 64)
+}
+
+// MustUint64 is like Uint64 but panics with the error.
+func MustUint64(vals url.Values, name string, def uint64) uint64 {
+	rv, err := Uint64(vals, name, def)
+	must(err)
+	return rv
+}
+
+// MustRequiredUint64 is like RequiredUint64 but panics with the error.
+func MustRequiredUint64(vals url.Values, name string) uint64 {
+	rv, err := RequiredUint64(vals, name)
+	must(err)
+	return rv
+}
+
+// Int32 parses the parameter name in vals as an integer, returning def if it's
+// missing.
+func Int32(vals url.Values, name string, def int32) (int32, error) {
+	rv, err := parseInt(vals, name, false, int64(def), 32)
+	return int32(rv), err
+}
+
+// RequiredInt32 is like Int32 but the parameter must be given.
+func RequiredInt32(vals url.Values, name string) (int32, error) {
+	rv, err := parseInt(vals, name, true, 0, 32)
+	return int32(rv), err
+}
+
+// MustInt32 is like Int32 but panics with the error.
+func MustInt32(vals url.Values, name string, def int32) int32 {
+	rv, err := Int32(vals, name, def)
+	must(err)
+	return rv
+}
+
+// MustRequiredInt32 is like RequiredInt32 but panics with the error.
+func MustRequiredInt32(vals url.Values, name string) int32 {
+	rv, err := RequiredInt32(vals, name)
+	must(err)
+	return rv
+}
+
+// Uint32 parses the parameter name in vals as a non-negative integer, returning
+// def if it's missing.
+func Uint32(vals url.Values, name string, def uint32) (uint32, error) {
+	rv, err := parseUint(vals, name, false, uint64(def), 32)
+	return uint32(rv), err
+}
+
+// RequiredUint32 is like Uint32 but the parameter must be given.
+func RequiredUint32(vals url.Values, name string) (uint32, error) {
+	rv, err := parseUint(vals, name, true, 0, 32)
+	return uint32(rv), err
+}
+
+// MustUint32 is like Uint32 but panics with the error.
+func MustUint32(vals url.Values, name string, def uint32) uint32 {
+	rv, err := Uint32(vals, name, def)
+	must(err)
+	return rv
+}
+
+// MustRequiredUint32 is like RequiredUint32 but panics with the error.
+func MustRequiredUint32(vals url.Values, name string) uint32 {
+	rv, err := RequiredUint32(vals, name)
+	must(err)
+	return rv
+}
+
+// Int parses the parameter name in vals as an integer, returning def if it's
+// missing.
+func Int(vals url.Values, name string, def int) (int, error) {
+	rv, err := parseInt(vals, name, false, int64(def), 0)
+	return int(rv), err
+}
+
+// RequiredInt is like Int but the parameter must be given.
+func RequiredInt(vals url.Values, name string) (int, error) {
+	rv, err := parseInt(vals, name, true, 0, 0)
+	return int(rv), err
+}
+
+// MustInt is like Int but panics with the error.
+func MustInt(vals url.Values, name string, def int) int {
+	rv, err := Int(vals, name, def)
+	must(err)
+	return rv
+}
+
+// MustRequiredInt is like RequiredInt but panics with the error.
+func MustRequiredInt(vals url.Values, name string) int {
+	rv, err := RequiredInt(vals, name)
+	must(err)
+	return rv
+}
+
+// Uint parses the parameter name in vals as a non-negative integer, returning
+// def if it's missing.
+func Uint(vals url.Values, name string, def uint) (uint, error) {
+	rv, err := parseUint(vals, name, false, uint64(def), 0)
+	return uint(rv), err
+}
+
+// RequiredUint is like Uint but the parameter must be given.
+func RequiredUint(vals url.Values, name string) (uint, error) {
+	rv, err := parseUint(vals, name, true, 0, 0)
+	return uint(rv), err
+}
+
+// MustUint is like Uint but panics with the error.
+func MustUint(vals url.Values, name string, def uint) uint {
+	rv, err := Uint(vals, name, def)
+	must(err)
+	return rv
+}
+
+// MustRequiredUint is like RequiredUint but panics with the error.
+func MustRequiredUint(vals url.Values, name string) uint {
+	rv, err := RequiredUint(vals, name)
+	must(err)
+	return rv
+}
+
+// Float64 parses the parameter name in vals as a number, returning def if it's
+// missing.
+func Float64(vals url.Values, name string, def float64) (float64, error) {
+	return parseFloat(vals, name, false, def, 64)
+}
+
+// RequiredFloat64 is like Float64 but the parameter must be given.
+func RequiredFloat64(vals url.Values, name string) (float64, error) {
+	return parseFloat(vals, name, true, 0, 64)
+}
+
+// MustFloat64 is like Float64 but panics with the error.
+func MustFloat64(vals url.Values, name string, def float64) float64 {
+	rv, err := Float64(vals, name, def)
+	must(err)
+	return rv
+}
+
+// MustRequiredFloat64 is like RequiredFloat64 but panics with the error.
+func MustRequiredFloat64(vals url.Values, name string) float64 {
+	rv, err := RequiredFloat64(vals, name)
+	must(err)
+	return rv
+}
+
+// Float32 parses the parameter name in vals as a number, returning def if it's
+// missing.
+func Float32(vals url.Values, name string, def float32) (float32, error) {
+	rv, err := parseFloat(vals, name, false, float64(def), 32)
+	return float32(rv), err
+}
+
+// RequiredFloat32 is like Float32 but the parameter must be given.
+func RequiredFloat32(vals url.Values, name string) (float32, error) {
+	rv, err := parseFloat(vals, name, true, 0, 32)
+	return float32(rv), err
+}
+
+// MustFloat32 is like Float32 but panics with the error.
+func MustFloat32(vals url.Values, name string, def float32) float32 {
+	rv, err := Float32(vals, name, def)
+	must(err)
+	return rv
+}
+
+// MustRequiredFloat32 is like RequiredFloat32 but panics with the error.
+func MustRequiredFloat32(vals url.Values, name string) float32 {
+	rv, err := RequiredFloat32(vals, name)
+	must(err)
+	return rv
+}
+
+// Bool parses the parameter name in vals as a bool (see ParseBool),
+// returning def if it's missing.
+func Bool(vals url.Values, name string, def bool) (bool, error) {
+	return parseBool(vals, name, false, def)
+}
+
+// RequiredBool is like Bool but the parameter must be given.
+func RequiredBool(vals url.Values, name string) (bool, error) {
+	return parseBool(vals, name, true, false)
+}
+
+// MustBool is like Bool but panics with the error.
+func MustBool(vals url.Values, name string, def bool) bool {
+	rv, err := Bool(vals, name, def)
+	must(err)
+	return rv
+}
+
+// MustRequiredBool is like RequiredBool but panics with the error.
+func MustRequiredBool(vals url.Values, name string) bool {
+	rv, err := RequiredBool(vals, name)
+	must(err)
+	return rv
+}
+
+func parseBool(vals url.Values, name string, required, def bool) (
+	bool, error) {
+	val, ok, err := param(vals, name, required)
+	if !ok {
+		return def, err
+	}
+	rv, err := ParseBool(val)
+	if err != nil {
+		return def, invalidParam(name, val, "a boolean")
+	}
+	return rv, nil
+}
+
+// RequiredString returns the parameter name in vals, which must be given.
+func RequiredString(vals url.Values, name string) (string, error) {
+	val, _, err := param(vals, name, true)
+	return val, err
+}
+
+// MustRequiredString is like RequiredString but panics with the error.
+func MustRequiredString(vals url.Values, name string) string {
+	rv, err := RequiredString(vals, name)
+	must(err)
+	return rv
+}
@@ -0,0 +1,56 @@
+// Copyright (C) 2017 JT Olds
+// See LICENSE for copying information
+
+package whparse_test
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"gopkg.in/webhelp.v1/wherr"
+	"gopkg.in/webhelp.v1/whparse"
+)
+
+func TestStrict(t *testing.T) {
+	vals := url.Values{"limit": {"abc"}, "offset": {"10"}, "big": {"300"}}
+
+	if v, err := whparse.Int(vals, "offset", 0); err != nil || v != 10 {
+		t.Fatalf("unexpected result: %v %v", v, err)
+	}
+	if v, err := whparse.Int(vals, "missing", 5); err != nil || v != 5 {
+		t.Fatalf("unexpected result: %v %v", v, err)
+	}
+
+	v, err := whparse.Int(vals, "limit", 5)
+	if v != 5 || wherr.StatusCode(err) != http.StatusBadRequest ||
+		!strings.Contains(err.Error(), `"limit"`) ||
+		wherr.FieldErrors(err)[0].Field != "limit" {
+		t.Fatalf("unexpected result: %v %v", v, err)
+	}
+
+	if _, err := whparse.Uint32(vals, "big", 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := whparse.Int32(url.Values{"n": {"3000000000"}}, "n",
+		0); err == nil {
+		t.Fatal("expected overflow error")
+	}
+
+	_, err = whparse.RequiredBool(vals, "verbose")
+	if fields := wherr.FieldErrors(err); len(fields) != 1 ||
+		fields[0].Code != "required" {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	func() {
+		defer func() {
+			if rec := recover(); rec == nil ||
+				wherr.StatusCode(rec.(error)) != http.StatusBadRequest {
+				t.Fatalf("unexpected panic: %v", rec)
+			}
+		}()
+		whparse.MustFloat64(vals, "limit", 0)
+	}()
+}
@@ -0,0 +1,340 @@
+// Copyright (C) 2017 JT Olds
+// See LICENSE for copying information
+
+package whparse
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ParseTime parses val as an RFC 3339 timestamp, like
+// "2017-01-02T15:04:05Z", or a plain date, like "2017-01-02", which is taken
+// to be midnight UTC.
+func ParseTime(val string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, val); err == nil {
+		return t, nil
+	}
+	return time.Parse("2006-01-02", val)
+}
+
+// OptDuration parses val as a duration like "5m" or "1h30m" (see
+// time.ParseDuration), unless parsing fails, in which case the default def
+// is returned.
+func OptDuration(val string, def time.Duration) time.Duration {
+	if val == "" {
+		return def
+	}
+	rv, err := time.ParseDuration(val)
+	if err != nil {
+		return def
+	}
+	return rv
+}
+
+// OptTime parses val with ParseTime, unless parsing fails, in which case the
+// default def is returned.
+func OptTime(val string, def time.Time) time.Time {
+	if val == "" {
+		return def
+	}
+	rv, err := ParseTime(val)
+	if err != nil {
+		return def
+	}
+	return rv
+}
+
+// OptList splits val on commas, trimming spaces and dropping empty elements.
+// If there are no elements, the default def is returned.
+func OptList(val string, def []string) []string {
+	var rv []string
+	for _, elem := range strings.Split(val, ",") {
+		if elem = strings.TrimSpace(elem); elem != "" {
+			rv = append(rv, elem)
+		}
+	}
+	if len(rv) == 0 {
+		return def
+	}
+	return rv
+}
+
+// OptEnum returns the element of allowed that val matches, ignoring case,
+// so the result is always spelled like the allowed value. If val doesn't
+// match any of them, the default def is returned.
+func OptEnum(val string, def string, allowed ...string) string {
+	if rv, ok := matchEnum(val, allowed); ok {
+		return rv
+	}
+	return def
+}
+
+// IntRange is an inclusive range of integers, like "10-20".
+type IntRange struct {
+	Min, Max int64
+}
+
+func (r IntRange) String() string {
+	return fmt.Sprintf("%d-%d", r.Min, r.Max)
+}
+
+// Contains returns true if val is within the range.
+func (r IntRange) Contains(val int64) bool {
+	return r.Min <= val && val <= r.Max
+}
+
+// ParseRange parses val as a range of non-negative integers, like "10-20".
+// A single integer, like "10", is a range with just that value. The start
+// of the range can't be greater than the end.
+func ParseRange(val string) (IntRange, error) {
+	parts := strings.SplitN(val, "-", 2)
+	min, err := strconv.ParseInt(strings.TrimSpace(parts[0]), 10, 64)
+	if err != nil || min < 0 {
+		return IntRange{}, fmt.Errorf("invalid range %#v", val)
+	}
+	max := min
+	if len(parts) == 2 {
+		max, err = strconv.ParseInt(strings.TrimSpace(parts[1]), 10, 64)
+		if err != nil || max < min {
+			return IntRange{}, fmt.Errorf("invalid range %#v", val)
+		}
+	}
+	return IntRange{Min: min, Max: max}, nil
+}
+
+// OptRange parses val with ParseRange, unless parsing fails, in which case
+// the default def is returned.
+func OptRange(val string, def IntRange) IntRange {
+	if val == "" {
+		return def
+	}
+	rv, err := ParseRange(val)
+	if err != nil {
+		return def
+	}
+	return rv
+}
+
+func matchEnum(val string, allowed []string) (string, bool) {
+	for _, option := range allowed {
+		if strings.EqualFold(val, option) {
+			return option, true
+		}
+	}
+	return "", false
+}
+
+// Duration parses the parameter name in vals as a duration like "5m" (see
+// time.ParseDuration), returning def if it's missing.
+func Duration(vals url.Values, name string, def time.Duration) (
+	time.Duration, error) {
+	return parseDuration(vals, name, false, def)
+}
+
+// RequiredDuration is like Duration but the parameter must be given.
+func RequiredDuration(vals url.Values, name string) (time.Duration, error) {
+	return parseDuration(vals, name, true, 0)
+}
+
+// MustDuration is like Duration but panics with the error.
+func MustDuration(vals url.Values, name string,
+	def time.Duration) time.Duration {
+	rv, err := Duration(vals, name, def)
+	must(err)
+	return rv
+}
+
+// MustRequiredDuration is like RequiredDuration but panics with the error.
+func MustRequiredDuration(vals url.Values, name string) time.Duration {
+	rv, err := RequiredDuration(vals, name)
+	must(err)
+	return rv
+}
+
+func parseDuration(vals url.Values, name string, required bool,
+	def time.Duration) (time.Duration, error) {
+	val, ok, err := param(vals, name, required)
+	if !ok {
+		return def, err
+	}
+	rv, err := time.ParseDuration(val)
+	if err != nil {
+		return def, invalidParam(name, val, `a duration like "5m"`)
+	}
+	return rv, nil
+}
+
+// Time parses the parameter name in vals with ParseTime, returning def if
+// it's missing.
+func Time(vals url.Values, name string, def time.Time) (time.Time, error) {
+	return parseTime(vals, name, false, def)
+}
+
+// RequiredTime is like Time but the parameter must be given.
+func RequiredTime(vals url.Values, name string) (time.Time, error) {
+	return parseTime(vals, name, true, time.Time{})
+}
+
+// MustTime is like Time but panics with the error.
+func MustTime(vals url.Values, name string, def time.Time) time.Time {
+	rv, err := Time(vals, name, def)
+	must(err)
+	return rv
+}
+
+// MustRequiredTime is like RequiredTime but panics with the error.
+func MustRequiredTime(vals url.Values, name string) time.Time {
+	rv, err := RequiredTime(vals, name)
+	must(err)
+	return rv
+}
+
+func parseTime(vals url.Values, name string, required bool,
+	def time.Time) (time.Time, error) {
+	val, ok, err := param(vals, name, required)
+	if !ok {
+		return def, err
+	}
+	rv, err := ParseTime(val)
+	if err != nil {
+		return def, invalidParam(name, val, "an RFC 3339 time or a date")
+	}
+	return rv, nil
+}
+
+// List returns the comma-separated elements of all of the values of the
+// parameter name in vals, so "?tag=a,b&tag=c" is a list of "a", "b", and
+// "c". Spaces around elements are trimmed. Unlike OptList, empty elements
+// are an error. If the parameter is missing, def is returned.
+func List(vals url.Values, name string, def []string) ([]string, error) {
+	return parseList(vals, name, false, def)
+}
+
+// RequiredList is like List but the parameter must be given with at least
+// one element.
+func RequiredList(vals url.Values, name string) ([]string, error) {
+	return parseList(vals, name, true, nil)
+}
+
+// MustList is like List but panics with the error.
+func MustList(vals url.Values, name string, def []string) []string {
+	rv, err := List(vals, name, def)
+	must(err)
+	return rv
+}
+
+// MustRequiredList is like RequiredList but panics with the error.
+func MustRequiredList(vals url.Values, name string) []string {
+	rv, err := RequiredList(vals, name)
+	must(err)
+	return rv
+}
+
+func parseList(vals url.Values, name string, required bool,
+	def []string) ([]string, error) {
+	var rv []string
+	for _, val := range vals[name] {
+		if val == "" {
+			continue
+		}
+		for _, elem := range strings.Split(val, ",") {
+			if elem = strings.TrimSpace(elem); elem == "" {
+				return def, invalidParam(name, val,
+					"a comma-separated list without empty elements")
+			}
+			rv = append(rv, elem)
+		}
+	}
+	if len(rv) == 0 {
+		// param returns the missing parameter error if it's required.
+		_, _, err := param(nil, name, required)
+		return def, err
+	}
+	return rv, nil
+}
+
+// Enum returns the element of allowed that the parameter name in vals
+// matches, ignoring case, or def if it's missing. The error for a value that
+// doesn't match lists the allowed values.
+func Enum(vals url.Values, name string, def string, allowed ...string) (
+	string, error) {
+	return parseEnum(vals, name, false, def, allowed)
+}
+
+// RequiredEnum is like Enum but the parameter must be given.
+func RequiredEnum(vals url.Values, name string, allowed ...string) (
+	string, error) {
+	return parseEnum(vals, name, true, "", allowed)
+}
+
+// MustEnum is like Enum but panics with the error.
+func MustEnum(vals url.Values, name string, def string,
+	allowed ...string) string {
+	rv, err := Enum(vals, name, def, allowed...)
+	must(err)
+	return rv
+}
+
+// MustRequiredEnum is like RequiredEnum but panics with the error.
+func MustRequiredEnum(vals url.Values, name string,
+	allowed ...string) string {
+	rv, err := RequiredEnum(vals, name, allowed...)
+	must(err)
+	return rv
+}
+
+func parseEnum(vals url.Values, name string, required bool, def string,
+	allowed []string) (string, error) {
+	val, ok, err := param(vals, name, required)
+	if !ok {
+		return def, err
+	}
+	rv, ok := matchEnum(val, allowed)
+	if !ok {
+		return def, invalidParam(name, val,
+			"one of "+strings.Join(allowed, ", "))
+	}
+	return rv, nil
+}
+
+// Range parses the parameter name in vals with ParseRange, returning def if
+// it's missing.
+func Range(vals url.Values, name string, def IntRange) (IntRange, error) {
+	return parseRangeParam(vals, name, false, def)
+}
+
+// RequiredRange is like Range but the parameter must be given.
+func RequiredRange(vals url.Values, name string) (IntRange, error) {
+	return parseRangeParam(vals, name, true, IntRange{})
+}
+
+// MustRange is like Range but panics with the error.
+func MustRange(vals url.Values, name string, def IntRange) IntRange {
+	rv, err := Range(vals, name, def)
+	must(err)
+	return rv
+}
+
+// MustRequiredRange is like RequiredRange but panics with the error.
+func MustRequiredRange(vals url.Values, name string) IntRange {
+	rv, err := RequiredRange(vals, name)
+	must(err)
+	return rv
+}
+
+func parseRangeParam(vals url.Values, name string, required bool,
+	def IntRange) (IntRange, error) {
+	val, ok, err := param(vals, name, required)
+	if !ok {
+		return def, err
+	}
+	rv, err := ParseRange(val)
+	if err != nil {
+		return def, invalidParam(name, val, `a range like "10-20"`)
+	}
+	return rv, nil
+}
@@ -0,0 +1,82 @@
+// Copyright (C) 2017 JT Olds
+// See LICENSE for copying information
+
+package whparse_test
+
+import (
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"gopkg.in/webhelp.v1/whparse"
+)
+
+func TestValues(t *testing.T) {
+	vals := url.Values{
+		"wait":  {"1m30s"},
+		"since": {"2017-01-02"},
+		"tag":   {"a, b", "c"},
+		"bad":   {"a,,b"},
+		"sort":  {"NAME"},
+		"ages":  {"10-20"},
+	}
+
+	if d := whparse.MustDuration(vals, "wait", 0); d != 90*time.Second {
+		t.Fatalf("unexpected duration %v", d)
+	}
+	since := whparse.MustTime(vals, "since", time.Time{})
+	if !since.Equal(time.Date(2017, 1, 2, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("unexpected time %v", since)
+	}
+	if l := whparse.MustList(vals, "tag", nil); !reflect.DeepEqual(l,
+		[]string{"a", "b", "c"}) {
+		t.Fatalf("unexpected list %v", l)
+	}
+	if _, err := whparse.List(vals, "bad", nil); err == nil {
+		t.Fatal("expected error for empty list element")
+	}
+	if l := whparse.OptList("a,,b", nil); !reflect.DeepEqual(l,
+		[]string{"a", "b"}) {
+		t.Fatalf("unexpected list %v", l)
+	}
+	if s := whparse.MustEnum(vals, "sort", "id", "id", "name"); s != "name" {
+		t.Fatalf("unexpected enum %v", s)
+	}
+	_, err := whparse.Enum(vals, "sort", "id", "id", "date")
+	if err == nil || !strings.Contains(err.Error(), "one of id, date") {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	r := whparse.MustRange(vals, "ages", whparse.IntRange{})
+	if r != (whparse.IntRange{Min: 10, Max: 20}) || !r.Contains(15) {
+		t.Fatalf("unexpected range %v", r)
+	}
+	if _, err := whparse.ParseRange("20-10"); err == nil {
+		t.Fatal("expected error for backwards range")
+	}
+	if d := whparse.OptDuration("soon", time.Second); d != time.Second {
+		t.Fatalf("unexpected duration %v", d)
+	}
+}
+
+func TestRequiredValues(t *testing.T) {
+	vals := url.Values{"wait": {"5s"}, "tag": {""}}
+
+	if d, err := whparse.RequiredDuration(vals, "wait"); err != nil ||
+		d != 5*time.Second {
+		t.Fatalf("unexpected duration %v: %v", d, err)
+	}
+	if _, err := whparse.RequiredTime(vals, "since"); err == nil {
+		t.Fatal("expected error for missing time")
+	}
+	if _, err := whparse.RequiredList(vals, "tag"); err == nil {
+		t.Fatal("expected error for empty list")
+	}
+	if _, err := whparse.RequiredEnum(vals, "sort", "id"); err == nil {
+		t.Fatal("expected error for missing enum")
+	}
+	if _, err := whparse.RequiredRange(vals, "ages"); err == nil {
+		t.Fatal("expected error for missing range")
+	}
+}
@@ -0,0 +1,341 @@
+// Copyright (C) 2017 JT Olds
+// See LICENSE for copying information
+
+package whquery
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/webhelp.v1/wherr"
+	"gopkg.in/webhelp.v1/whparse"
+)
+
+var timeType = reflect.TypeOf(time.Time{})
+
+type matcher func(v reflect.Value) bool
+
+// Predicate compiles expr into a function that reports whether a value of
+// the same struct type as sample (or a pointer to one) matches. A nil expr
+// matches everything.
+//
+// Field names are matched with the struct's "json" tag names, or field names
+// if there is no tag, and can refer to nested struct fields with dots, like
+// "author.name". Values are interpreted by field type: strings compare as
+// strings, numeric fields need numbers, bool fields need a bool (see
+// whparse.ParseBool), and time.Time fields need a whparse.ParseTime value.
+// The bare word null matches nil pointers, slices, maps, and interfaces, and
+// only works with eq and ne. contains and startswith only work with strings,
+// and bool fields only work with eq and ne.
+//
+// Values that don't fit their field are reported as wherr.BadRequest errors.
+// Fields that don't exist in the struct are reported as
+// wherr.InternalServerError errors, since they should have been excluded by
+// the allowed fields passed to ParseFilter.
+func Predicate(expr Expr, sample interface{}) (func(v interface{}) bool,
+	error) {
+	typ := reflect.TypeOf(sample)
+	for typ != nil && typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	if typ == nil || typ.Kind() != reflect.Struct {
+		return nil, wherr.InternalServerError.New(
+			"whquery: Predicate needs a struct, not %T", sample)
+	}
+	if expr == nil {
+		return func(interface{}) bool { return true }, nil
+	}
+	m, err := compile(expr, typ)
+	if err != nil {
+		return nil, err
+	}
+	return func(v interface{}) bool {
+		rv := reflect.ValueOf(v)
+		if !rv.IsValid() {
+			return false
+		}
+		for rv.Kind() == reflect.Ptr {
+			if rv.IsNil() {
+				return false
+			}
+			rv = rv.Elem()
+		}
+		if rv.Type() != typ {
+			return false
+		}
+		return m(rv)
+	}, nil
+}
+
+func compile(expr Expr, typ reflect.Type) (matcher, error) {
+	switch e := expr.(type) {
+	case *And:
+		left, right, err := compileBoth(e.Left, e.Right, typ)
+		if err != nil {
+			return nil, err
+		}
+		return func(v reflect.Value) bool { return left(v) && right(v) }, nil
+	case *Or:
+		left, right, err := compileBoth(e.Left, e.Right, typ)
+		if err != nil {
+			return nil, err
+		}
+		return func(v reflect.Value) bool { return left(v) || right(v) }, nil
+	case *Not:
+		inner, err := compile(e.Expr, typ)
+		if err != nil {
+			return nil, err
+		}
+		return func(v reflect.Value) bool { return !inner(v) }, nil
+	case *Comparison:
+		return compileComparison(e, typ)
+	}
+	return nil, wherr.InternalServerError.New("whquery: unknown expr %T",
+		expr)
+}
+
+func compileBoth(left, right Expr, typ reflect.Type) (matcher, matcher,
+	error) {
+	l, err := compile(left, typ)
+	if err != nil {
+		return nil, nil, err
+	}
+	r, err := compile(right, typ)
+	if err != nil {
+		return nil, nil, err
+	}
+	return l, r, nil
+}
+
+// fieldIndex finds the field path for a dotted field name.
+func fieldIndex(typ reflect.Type, name string) ([]int, reflect.Type, bool) {
+	var index []int
+	for _, part := range strings.Split(name, ".") {
+		for typ.Kind() == reflect.Ptr {
+			typ = typ.Elem()
+		}
+		if typ.Kind() != reflect.Struct {
+			return nil, nil, false
+		}
+		found := false
+		for i := 0; i < typ.NumField(); i++ {
+			field := typ.Field(i)
+			if field.PkgPath != "" {
+				continue
+			}
+			tagName := strings.Split(field.Tag.Get("json"), ",")[0]
+			if tagName == part || (tagName == "" && field.Name == part) {
+				index = append(index, i)
+				typ = field.Type
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, nil, false
+		}
+	}
+	return index, typ, true
+}
+
+// fieldValue follows index from v, returning ok = false if it runs into a
+// nil pointer along the way.
+func fieldValue(v reflect.Value, index []int) (reflect.Value, bool) {
+	for _, i := range index {
+		for v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				return reflect.Value{}, false
+			}
+			v = v.Elem()
+		}
+		v = v.Field(i)
+	}
+	return v, true
+}
+
+func isNil(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface, reflect.Slice, reflect.Map:
+		return v.IsNil()
+	}
+	return false
+}
+
+func compileComparison(c *Comparison, typ reflect.Type) (matcher, error) {
+	index, fieldType, ok := fieldIndex(typ, c.Field)
+	if !ok {
+		return nil, wherr.InternalServerError.New(
+			"whquery: %v has no field %#v", typ, c.Field)
+	}
+	invalid := func(expected string) error {
+		return badParam("filter", "invalid value %s for %#v, expected %s",
+			c.Value, c.Field, expected)
+	}
+
+	if c.Value.IsNull() {
+		if c.Op != Eq && c.Op != Ne {
+			return nil, unsupportedOp(c)
+		}
+		wantNil := c.Op == Eq
+		return func(v reflect.Value) bool {
+			fv, ok := fieldValue(v, index)
+			return (!ok || isNil(fv)) == wantNil
+		}, nil
+	}
+
+	for fieldType.Kind() == reflect.Ptr {
+		fieldType = fieldType.Elem()
+	}
+	cmp, err := comparer(fieldType, c, invalid)
+	if err != nil {
+		return nil, err
+	}
+	op := c.Op
+	return func(v reflect.Value) bool {
+		fv, ok := fieldValue(v, index)
+		for ok && fv.Kind() == reflect.Ptr {
+			if fv.IsNil() {
+				ok = false
+				break
+			}
+			fv = fv.Elem()
+		}
+		if !ok {
+			// a missing value is unequal to everything and otherwise
+			// incomparable.
+			return op == Ne
+		}
+		return cmp(fv)
+	}, nil
+}
+
+// comparer returns a matcher for non-pointer values of fieldType.
+func comparer(fieldType reflect.Type, c *Comparison,
+	invalid func(expected string) error) (matcher, error) {
+	raw, op := c.Value.Raw, c.Op
+
+	if fieldType == timeType {
+		want, err := whparse.ParseTime(raw)
+		if err != nil {
+			return nil, invalid("an RFC 3339 time or a date")
+		}
+		return ordered(c, func(v reflect.Value) int {
+			got := v.Interface().(time.Time)
+			switch {
+			case got.Before(want):
+				return -1
+			case got.After(want):
+				return 1
+			}
+			return 0
+		})
+	}
+
+	switch fieldType.Kind() {
+	case reflect.String:
+		switch op {
+		case Contains:
+			return func(v reflect.Value) bool {
+				return strings.Contains(v.String(), raw)
+			}, nil
+		case StartsWith:
+			return func(v reflect.Value) bool {
+				return strings.HasPrefix(v.String(), raw)
+			}, nil
+		}
+		return ordered(c, func(v reflect.Value) int {
+			return strings.Compare(v.String(), raw)
+		})
+	case reflect.Bool:
+		want, err := whparse.ParseBool(raw)
+		if err != nil {
+			return nil, invalid("true or false")
+		}
+		if op != Eq && op != Ne {
+			return nil, unsupportedOp(c)
+		}
+		return func(v reflect.Value) bool {
+			return (v.Bool() == want) == (op == Eq)
+		}, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32,
+		reflect.Int64:
+		want, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return nil, invalid("an integer")
+		}
+		return ordered(c, func(v reflect.Value) int {
+			got := v.Int()
+			switch {
+			case got < want:
+				return -1
+			case got > want:
+				return 1
+			}
+			return 0
+		})
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32,
+		reflect.Uint64:
+		want, err := strconv.ParseUint(raw, 10, 64)
+		if err != nil {
+			return nil, invalid("a non-negative integer")
+		}
+		return ordered(c, func(v reflect.Value) int {
+			got := v.Uint()
+			switch {
+			case got < want:
+				return -1
+			case got > want:
+				return 1
+			}
+			return 0
+		})
+	case reflect.Float32, reflect.Float64:
+		want, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return nil, invalid("a number")
+		}
+		return ordered(c, func(v reflect.Value) int {
+			return compareFloats(v.Float(), want)
+		})
+	}
+	return nil, badParam("filter", "can't filter by %#v", c.Field)
+}
+
+func compareFloats(a, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+func unsupportedOp(c *Comparison) error {
+	return badParam("filter", "%s can't be used with %#v %s", c.Op, c.Field,
+		c.Value)
+}
+
+// ordered turns a three-way comparison into a matcher for c.Op.
+func ordered(c *Comparison, cmp func(v reflect.Value) int) (matcher, error) {
+	var ok func(c int) bool
+	switch c.Op {
+	case Eq:
+		ok = func(c int) bool { return c == 0 }
+	case Ne:
+		ok = func(c int) bool { return c != 0 }
+	case Gt:
+		ok = func(c int) bool { return c > 0 }
+	case Ge:
+		ok = func(c int) bool { return c >= 0 }
+	case Lt:
+		ok = func(c int) bool { return c < 0 }
+	case Le:
+		ok = func(c int) bool { return c <= 0 }
+	default:
+		return nil, unsupportedOp(c)
+	}
+	return func(v reflect.Value) bool { return ok(cmp(v)) }, nil
+}
@@ -0,0 +1,436 @@
+// Copyright (C) 2017 JT Olds
+// See LICENSE for copying information
+
+// Package whquery parses a small filter and sort language for list
+// endpoints, like
+//
+//   ?filter=status eq "open" and created gt 2017-01-01&sort=-created,name
+//
+// Filters are comparisons of a field to a value, combined with "and", "or",
+// "not", and parentheses:
+//
+//   filter     = or
+//   or         = and { "or" and }
+//   and        = unary { "and" unary }
+//   unary      = "not" unary | "(" or ")" | comparison
+//   comparison = field op value
+//   op         = "eq" | "ne" | "gt" | "ge" | "lt" | "le" |
+//                "contains" | "startswith"
+//   value      = quoted-string | bare-word
+//
+// Keywords and operators are case-insensitive. "and" binds tighter than
+// "or". Quoted strings use double quotes, with backslash escaping a quote or
+// a backslash. Bare words (like 42, true, null, or 2017-01-01) run until
+// whitespace or a parenthesis, and are interpreted according to the type of
+// the field they're compared with (see Predicate).
+//
+// Sorts are comma-separated field names, each optionally prefixed with "-"
+// for descending order (or "+" for ascending, the default).
+//
+// Callers declare which fields may be filtered and sorted on, and anything
+// else is a wherr.BadRequest error.
+package whquery // import "gopkg.in/webhelp.v1/whparse/whquery"
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"gopkg.in/webhelp.v1/wherr"
+)
+
+// Op is a comparison operator.
+type Op string
+
+// The supported comparison operators.
+const (
+	Eq         Op = "eq"
+	Ne         Op = "ne"
+	Gt         Op = "gt"
+	Ge         Op = "ge"
+	Lt         Op = "lt"
+	Le         Op = "le"
+	Contains   Op = "contains"
+	StartsWith Op = "startswith"
+)
+
+var ops = map[Op]bool{Eq: true, Ne: true, Gt: true, Ge: true, Lt: true,
+	Le: true, Contains: true, StartsWith: true}
+
+// Expr is a node in a parsed filter. It is one of *And, *Or, *Not, or
+// *Comparison.
+type Expr interface {
+	// String returns the expression in the filter language.
+	String() string
+	expr()
+}
+
+// And matches if both sides match.
+type And struct {
+	Left, Right Expr
+}
+
+// Or matches if either side matches.
+type Or struct {
+	Left, Right Expr
+}
+
+// Not matches if Expr doesn't.
+type Not struct {
+	Expr Expr
+}
+
+// Comparison compares a field to a value.
+type Comparison struct {
+	Field string
+	Op    Op
+	Value Value
+}
+
+// Value is a value in a comparison. Raw is the unquoted text, and Quoted is
+// true if it was given as a quoted string, in which case it's never
+// interpreted as null.
+type Value struct {
+	Raw    string
+	Quoted bool
+}
+
+// IsNull returns true if the value is the bare word null.
+func (v Value) IsNull() bool {
+	return !v.Quoted && strings.EqualFold(v.Raw, "null")
+}
+
+func (v Value) String() string {
+	if v.Quoted {
+		return strconv.Quote(v.Raw)
+	}
+	return v.Raw
+}
+
+func (e *And) String() string {
+	return fmt.Sprintf("(%s and %s)", e.Left, e.Right)
+}
+
+func (e *Or) String() string {
+	return fmt.Sprintf("(%s or %s)", e.Left, e.Right)
+}
+
+func (e *Not) String() string { return fmt.Sprintf("not %s", e.Expr) }
+
+func (e *Comparison) String() string {
+	return fmt.Sprintf("%s %s %s", e.Field, e.Op, e.Value)
+}
+
+func (*And) expr()        {}
+func (*Or) expr()         {}
+func (*Not) expr()        {}
+func (*Comparison) expr() {}
+
+// SortKey is one field of a sort order.
+type SortKey struct {
+	Field string
+	Desc  bool
+}
+
+func (k SortKey) String() string {
+	if k.Desc {
+		return "-" + k.Field
+	}
+	return k.Field
+}
+
+// Fields declares which fields may be used in filters and sorts.
+type Fields struct {
+	Filter []string
+	Sort   []string
+}
+
+// Query is a parsed filter and sort order.
+type Query struct {
+	// Filter is nil if there was no filter.
+	Filter Expr
+	Sort   []SortKey
+}
+
+// Parse parses the "filter" and "sort" query parameters of r, allowing only
+// the given fields.
+func Parse(r *http.Request, fields Fields) (Query, error) {
+	vals := r.URL.Query()
+	filter, err := ParseFilter(vals.Get("filter"), fields.Filter...)
+	if err != nil {
+		return Query{}, err
+	}
+	sort, err := ParseSort(vals.Get("sort"), fields.Sort...)
+	if err != nil {
+		return Query{}, err
+	}
+	return Query{Filter: filter, Sort: sort}, nil
+}
+
+// MustParse is like Parse but panics with the error. Meant to be used with
+// whfatal.Catch, which will hand the error to wherr.Handle.
+func MustParse(r *http.Request, fields Fields) Query {
+	q, err := Parse(r, fields)
+	if err != nil {
+		panic(err)
+	}
+	return q
+}
+
+func badParam(param, format string, args ...interface{}) error {
+	return wherr.NewValidationError(wherr.BadRequest, wherr.FieldError{
+		Field:   param,
+		Code:    "invalid",
+		Message: fmt.Sprintf(format, args...)})
+}
+
+func allowedSet(allowed []string) map[string]bool {
+	set := make(map[string]bool, len(allowed))
+	for _, field := range allowed {
+		set[field] = true
+	}
+	return set
+}
+
+// ParseSort parses a sort order like "-created,name", allowing only the
+// given fields. An empty sort results in a nil slice.
+func ParseSort(sort string, allowed ...string) ([]SortKey, error) {
+	if strings.TrimSpace(sort) == "" {
+		return nil, nil
+	}
+	fields := allowedSet(allowed)
+	seen := map[string]bool{}
+	var keys []SortKey
+	for _, part := range strings.Split(sort, ",") {
+		part = strings.TrimSpace(part)
+		key := SortKey{Field: part}
+		switch {
+		case strings.HasPrefix(part, "-"):
+			key = SortKey{Field: part[1:], Desc: true}
+		case strings.HasPrefix(part, "+"):
+			key = SortKey{Field: part[1:]}
+		}
+		if !fields[key.Field] {
+			return nil, badParam("sort", "can't sort by %#v", key.Field)
+		}
+		if seen[key.Field] {
+			return nil, badParam("sort", "%#v is listed more than once",
+				key.Field)
+		}
+		seen[key.Field] = true
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// ParseFilter parses a filter expression, allowing comparisons on only the
+// given fields. An empty filter results in a nil Expr.
+func ParseFilter(filter string, allowed ...string) (Expr, error) {
+	tokens, err := tokenize(filter)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, nil
+	}
+	p := parser{tokens: tokens, fields: allowedSet(allowed)}
+	expr, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, p.errorf("unexpected %s", p.tokens[p.pos])
+	}
+	return expr, nil
+}
+
+type tokenKind int
+
+const (
+	wordToken tokenKind = iota
+	stringToken
+	openToken
+	closeToken
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+func (t token) String() string {
+	switch t.kind {
+	case stringToken:
+		return fmt.Sprintf("%q at position %d", t.text, t.pos)
+	default:
+		return fmt.Sprintf("%#v at position %d", t.text, t.pos)
+	}
+}
+
+func (t token) isKeyword(keyword string) bool {
+	return t.kind == wordToken && strings.EqualFold(t.text, keyword)
+}
+
+func tokenize(filter string) ([]token, error) {
+	var tokens []token
+	for i := 0; i < len(filter); {
+		switch c := filter[i]; {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '(':
+			tokens = append(tokens, token{kind: openToken, text: "(", pos: i})
+			i++
+		case c == ')':
+			tokens = append(tokens, token{kind: closeToken, text: ")", pos: i})
+			i++
+		case c == '"':
+			start := i
+			var text []byte
+			for i++; ; i++ {
+				if i >= len(filter) {
+					return nil, badParam("filter",
+						"unterminated string at position %d", start)
+				}
+				if filter[i] == '\\' && i+1 < len(filter) &&
+					(filter[i+1] == '"' || filter[i+1] == '\\') {
+					i++
+				} else if filter[i] == '"' {
+					i++
+					break
+				}
+				text = append(text, filter[i])
+			}
+			tokens = append(tokens,
+				token{kind: stringToken, text: string(text), pos: start})
+		default:
+			start := i
+			for i < len(filter) && !strings.ContainsRune(" \t\r\n()\"",
+				rune(filter[i])) {
+				i++
+			}
+			tokens = append(tokens,
+				token{kind: wordToken, text: filter[start:i], pos: start})
+		}
+	}
+	return tokens, nil
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+	fields map[string]bool
+}
+
+func (p *parser) errorf(format string, args ...interface{}) error {
+	return badParam("filter", format, args...)
+}
+
+func (p *parser) peek() (token, bool) {
+	if p.pos >= len(p.tokens) {
+		return token{}, false
+	}
+	return p.tokens[p.pos], true
+}
+
+func (p *parser) next(expected string) (token, error) {
+	t, ok := p.peek()
+	if !ok {
+		return token{}, p.errorf("expected %s at end of filter", expected)
+	}
+	p.pos++
+	return t, nil
+}
+
+func (p *parser) parseOr() (Expr, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t, ok := p.peek()
+		if !ok || !t.isKeyword("or") {
+			return left, nil
+		}
+		p.pos++
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &Or{Left: left, Right: right}
+	}
+}
+
+func (p *parser) parseAnd() (Expr, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t, ok := p.peek()
+		if !ok || !t.isKeyword("and") {
+			return left, nil
+		}
+		p.pos++
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = &And{Left: left, Right: right}
+	}
+}
+
+func (p *parser) parseUnary() (Expr, error) {
+	t, err := p.next("a comparison")
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case t.isKeyword("not"):
+		expr, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &Not{Expr: expr}, nil
+	case t.kind == openToken:
+		expr, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		closing, err := p.next(`")"`)
+		if err != nil {
+			return nil, err
+		}
+		if closing.kind != closeToken {
+			return nil, p.errorf(`expected ")", got %s`, closing)
+		}
+		return expr, nil
+	case t.kind != wordToken:
+		return nil, p.errorf("expected a field name, got %s", t)
+	}
+
+	if !p.fields[t.text] {
+		return nil, p.errorf("can't filter by %#v", t.text)
+	}
+	opToken, err := p.next("an operator")
+	if err != nil {
+		return nil, err
+	}
+	op := Op(strings.ToLower(opToken.text))
+	if opToken.kind != wordToken || !ops[op] {
+		return nil, p.errorf("expected an operator, got %s", opToken)
+	}
+	valToken, err := p.next("a value")
+	if err != nil {
+		return nil, err
+	}
+	if valToken.kind != wordToken && valToken.kind != stringToken {
+		return nil, p.errorf("expected a value, got %s", valToken)
+	}
+	return &Comparison{
+		Field: t.text,
+		Op:    op,
+		Value: Value{Raw: valToken.text, Quoted: valToken.kind == stringToken},
+	}, nil
+}
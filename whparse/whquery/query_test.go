@@ -0,0 +1,123 @@
+// Copyright (C) 2017 JT Olds
+// See LICENSE for copying information
+
+package whquery_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+
+	"gopkg.in/webhelp.v1/wherr"
+	"gopkg.in/webhelp.v1/whparse/whquery"
+)
+
+type ticket struct {
+	ID      int       `json:"id"`
+	Status  string    `json:"status"`
+	Created time.Time `json:"created"`
+	Urgent  bool      `json:"urgent"`
+	Owner   *string   `json:"owner"`
+}
+
+var fields = whquery.Fields{
+	Filter: []string{"id", "status", "created", "urgent", "owner"},
+	Sort:   []string{"id", "created"}}
+
+func query(filter, sort string) *http.Request {
+	return httptest.NewRequest("GET", "/?"+url.Values{
+		"filter": {filter}, "sort": {sort}}.Encode(), nil)
+}
+
+func TestParse(t *testing.T) {
+	q, err := whquery.Parse(query(
+		`status EQ "open \"now\"" and `+
+			`not (created gt 2017-01-01 or urgent eq true)`,
+		"-created, id"), fields)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if q.Filter.String() != `(status eq "open \"now\"" and `+
+		`not (created gt 2017-01-01 or urgent eq true))` {
+		t.Fatalf("unexpected filter: %s", q.Filter)
+	}
+	if !reflect.DeepEqual(q.Sort, []whquery.SortKey{
+		{Field: "created", Desc: true}, {Field: "id"}}) {
+		t.Fatalf("unexpected sort: %v", q.Sort)
+	}
+
+	for _, test := range []struct{ filter, sort string }{
+		{`secret eq 1`, ""},
+		{`status eq`, ""},
+		{`status like "x"`, ""},
+		{`(status eq "x"`, ""},
+		{`status eq "x`, ""},
+		{`status eq "x" "y"`, ""},
+		{"", "status"},
+		{"", "id,-id"},
+	} {
+		_, err := whquery.Parse(query(test.filter, test.sort), fields)
+		if wherr.StatusCode(err) != http.StatusBadRequest {
+			t.Fatalf("%q %q: expected bad request, got %v", test.filter,
+				test.sort, err)
+		}
+	}
+}
+
+func TestPredicate(t *testing.T) {
+	bob := "bob"
+	tickets := []ticket{
+		{ID: 1, Status: "open", Urgent: true, Owner: &bob,
+			Created: time.Date(2016, 5, 1, 0, 0, 0, 0, time.UTC)},
+		{ID: 2, Status: "closed",
+			Created: time.Date(2017, 5, 1, 0, 0, 0, 0, time.UTC)},
+		{ID: 3, Status: "opening",
+			Created: time.Date(2017, 6, 1, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, test := range []struct {
+		filter   string
+		expected []int
+	}{
+		{``, []int{1, 2, 3}},
+		{`status startswith open and created ge 2017-01-01`, []int{3}},
+		{`owner eq null`, []int{2, 3}},
+		{`owner eq "bob" or id gt 2`, []int{1, 3}},
+		{`not urgent eq yes`, []int{2, 3}},
+	} {
+		expr, err := whquery.ParseFilter(test.filter, fields.Filter...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		match, err := whquery.Predicate(expr, ticket{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []int
+		for i := range tickets {
+			if match(&tickets[i]) {
+				got = append(got, tickets[i].ID)
+			}
+		}
+		if test.filter != "" && (match(nil) || match((*ticket)(nil))) {
+			t.Fatalf("%s: nil matched", test.filter)
+		}
+		if !reflect.DeepEqual(got, test.expected) {
+			t.Fatalf("%s: expected %v, got %v", test.filter, test.expected, got)
+		}
+	}
+
+	for _, filter := range []string{
+		`id eq abc`, `urgent gt true`, `id contains 1`, `owner gt null`} {
+		expr, err := whquery.ParseFilter(filter, fields.Filter...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = whquery.Predicate(expr, ticket{})
+		if wherr.StatusCode(err) != http.StatusBadRequest {
+			t.Fatalf("%s: expected bad request, got %v", filter, err)
+		}
+	}
+}
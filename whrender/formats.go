@@ -0,0 +1,266 @@
+// Copyright (C) 2017 JT Olds
+// See LICENSE for copying information
+
+package whrender
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/csv"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"gopkg.in/webhelp.v1/wherr"
+	"gopkg.in/webhelp.v1/whjson"
+)
+
+var (
+	// JSON renders values like whjson.Render does.
+	JSON Format = jsonFormat{}
+
+	// XML renders values with encoding/xml, so elements are named by "xml"
+	// struct tags. If the request's whjson Encoder uses an envelope, the value
+	// is wrapped in an element named by the response key, like
+	// `<resp><row>...</row><row>...</row></resp>`. Otherwise the value must be
+	// something encoding/xml can marshal as a single document, like a struct.
+	// Errors are rendered as an element named by the error key, containing a
+	// <message> element and a <field name="..." code="..."> element per field
+	// error.
+	XML Format = xmlFormat{}
+
+	// CSV renders slices of structs as CSV, with a header row. Columns are
+	// named by the "csv" struct tag, then the "json" struct tag, then the
+	// field name, and fields tagged "-" are skipped. Other values are
+	// NotAcceptable. Errors are rendered as a header row of the error key,
+	// "field", and "code", followed by a row with the error message and a
+	// row per field error. CSV never uses an envelope.
+	CSV Format = csvFormat{}
+)
+
+type jsonFormat struct{}
+
+func (jsonFormat) Name() string { return "json" }
+
+func (jsonFormat) ContentTypes() []string {
+	return []string{"application/json"}
+}
+
+func (jsonFormat) Marshal(r *http.Request, value interface{}) (
+	[]byte, error) {
+	e := whjson.EncoderFor(r)
+	return e.Marshal(r, e.Wrap(value))
+}
+
+func (jsonFormat) MarshalError(r *http.Request, err error) ([]byte, error) {
+	e := whjson.EncoderFor(r)
+	return e.Marshal(r, e.ErrorValue(r, err))
+}
+
+type xmlFormat struct{}
+
+func (xmlFormat) Name() string { return "xml" }
+
+func (xmlFormat) ContentTypes() []string {
+	return []string{"application/xml", "text/xml"}
+}
+
+func (xmlFormat) Marshal(r *http.Request, value interface{}) (
+	[]byte, error) {
+	e := whjson.EncoderFor(r)
+	return marshalXML(e, func(enc *xml.Encoder) error {
+		if !e.Envelope {
+			return enc.Encode(value)
+		}
+		responseKey, _ := e.Keys()
+		start := xml.StartElement{Name: xml.Name{Local: responseKey}}
+		err := enc.EncodeToken(start)
+		if err == nil {
+			err = enc.Encode(value)
+		}
+		if err != nil {
+			return err
+		}
+		return enc.EncodeToken(start.End())
+	})
+}
+
+type xmlFieldError struct {
+	Field   string `xml:"name,attr"`
+	Code    string `xml:"code,attr"`
+	Message string `xml:",chardata"`
+}
+
+type xmlError struct {
+	XMLName xml.Name
+	Message string          `xml:"message"`
+	Fields  []xmlFieldError `xml:"field"`
+}
+
+func (xmlFormat) MarshalError(r *http.Request, err error) ([]byte, error) {
+	e := whjson.EncoderFor(r)
+	_, errorKey := e.Keys()
+	body := xmlError{
+		XMLName: xml.Name{Local: errorKey},
+		Message: wherr.Message(r, err)}
+	for _, fe := range wherr.LocalizedFieldErrors(r, err) {
+		body.Fields = append(body.Fields, xmlFieldError(fe))
+	}
+	return marshalXML(e, func(enc *xml.Encoder) error {
+		return enc.Encode(body)
+	})
+}
+
+func marshalXML(e *whjson.Encoder, encode func(enc *xml.Encoder) error) (
+	[]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+	enc := xml.NewEncoder(&buf)
+	enc.Indent("", e.Indent)
+	err := encode(enc)
+	if err == nil {
+		err = enc.Flush()
+	}
+	if err != nil {
+		if _, ok := err.(*xml.UnsupportedTypeError); ok {
+			return nil, wherr.NotAcceptable.New("can't render as XML: %v", err)
+		}
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+type csvFormat struct{}
+
+func (csvFormat) Name() string { return "csv" }
+
+func (csvFormat) ContentTypes() []string {
+	return []string{"text/csv"}
+}
+
+func (csvFormat) Marshal(r *http.Request, value interface{}) (
+	[]byte, error) {
+	v := reflect.ValueOf(value)
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+		return nil, wherr.NotAcceptable.New(
+			"CSV needs a slice of structs, not %T", value)
+	}
+	elemType := v.Type().Elem()
+	if elemType.Kind() == reflect.Ptr {
+		elemType = elemType.Elem()
+	}
+	if elemType.Kind() != reflect.Struct {
+		return nil, wherr.NotAcceptable.New(
+			"CSV needs a slice of structs, not %T", value)
+	}
+
+	columns := csvColumns(elemType, nil)
+	rows := make([][]string, 0, v.Len()+1)
+	header := make([]string, 0, len(columns))
+	for _, col := range columns {
+		header = append(header, col.name)
+	}
+	rows = append(rows, header)
+	for i := 0; i < v.Len(); i++ {
+		elem := v.Index(i)
+		row := make([]string, 0, len(columns))
+		for _, col := range columns {
+			row = append(row, csvCell(elem, col.index))
+		}
+		rows = append(rows, row)
+	}
+	return marshalCSV(rows)
+}
+
+func (csvFormat) MarshalError(r *http.Request, err error) ([]byte, error) {
+	_, errorKey := whjson.EncoderFor(r).Keys()
+	rows := [][]string{
+		{errorKey, "field", "code"},
+		{wherr.Message(r, err), "", ""}}
+	for _, fe := range wherr.LocalizedFieldErrors(r, err) {
+		rows = append(rows, []string{fe.Message, fe.Field, fe.Code})
+	}
+	return marshalCSV(rows)
+}
+
+func marshalCSV(rows [][]string) ([]byte, error) {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	err := w.WriteAll(rows)
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+type csvColumn struct {
+	name  string
+	index []int
+}
+
+func csvColumns(typ reflect.Type, index []int) (columns []csvColumn) {
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		if field.PkgPath != "" && !field.Anonymous {
+			continue
+		}
+		name := field.Tag.Get("csv")
+		if name == "" {
+			name = strings.Split(field.Tag.Get("json"), ",")[0]
+		}
+		if name == "-" {
+			continue
+		}
+		fieldIndex := append(append([]int(nil), index...), i)
+		if name == "" && field.Anonymous {
+			embedded := field.Type
+			if embedded.Kind() == reflect.Ptr {
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct {
+				columns = append(columns, csvColumns(embedded, fieldIndex)...)
+				continue
+			}
+		}
+		if field.PkgPath != "" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		columns = append(columns, csvColumn{name: name, index: fieldIndex})
+	}
+	return columns
+}
+
+func csvCell(v reflect.Value, index []int) string {
+	for _, i := range index {
+		for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+			if v.IsNil() {
+				return ""
+			}
+			v = v.Elem()
+		}
+		v = v.Field(i)
+	}
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return ""
+		}
+		v = v.Elem()
+	}
+	if v.CanInterface() {
+		if tm, ok := v.Interface().(encoding.TextMarshaler); ok {
+			text, err := tm.MarshalText()
+			if err == nil {
+				return string(text)
+			}
+		}
+	}
+	return fmt.Sprint(v)
+}
@@ -0,0 +1,284 @@
+// Copyright (C) 2017 JT Olds
+// See LICENSE for copying information
+
+package whrender
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+
+	"gopkg.in/webhelp.v1/wherr"
+	"gopkg.in/webhelp.v1/whjson"
+)
+
+var (
+	// MessagePack renders values as MessagePack, wrapped in the request's
+	// whjson Encoder envelope if it has one. Structs are encoded as maps
+	// keyed by their "json" struct tag names (honoring "-" and omitempty),
+	// encoding.TextMarshalers (like time.Time) as strings, and []byte as
+	// binary. Errors are rendered like the whjson error object.
+	MessagePack Format = msgpackFormat{}
+)
+
+type msgpackFormat struct{}
+
+func (msgpackFormat) Name() string { return "msgpack" }
+
+func (msgpackFormat) ContentTypes() []string {
+	return []string{"application/msgpack", "application/x-msgpack"}
+}
+
+func (msgpackFormat) Marshal(r *http.Request, value interface{}) (
+	[]byte, error) {
+	return marshalMsgpack(whjson.EncoderFor(r).Wrap(value))
+}
+
+func (msgpackFormat) MarshalError(r *http.Request, err error) (
+	[]byte, error) {
+	return marshalMsgpack(whjson.EncoderFor(r).ErrorValue(r, err))
+}
+
+func marshalMsgpack(value interface{}) ([]byte, error) {
+	var enc msgpackEncoder
+	err := enc.encode(reflect.ValueOf(value))
+	if err != nil {
+		return nil, err
+	}
+	return enc.buf.Bytes(), nil
+}
+
+var textMarshalerType = reflect.TypeOf(
+	(*encoding.TextMarshaler)(nil)).Elem()
+
+type msgpackEncoder struct {
+	buf bytes.Buffer
+}
+
+func (e *msgpackEncoder) writeByte(b byte) { e.buf.WriteByte(b) }
+
+func (e *msgpackEncoder) write(prefix byte, n interface{}) {
+	e.buf.WriteByte(prefix)
+	binary.Write(&e.buf, binary.BigEndian, n)
+}
+
+// writeLength writes a str, bin, array, or map header. fix is the fixed
+// size prefix (or 0 if the type has none) with fixMax its largest length,
+// and prefixes are the 8, 16, and 32 bit length prefixes (0 if missing).
+func (e *msgpackEncoder) writeLength(n int, fix byte, fixMax int,
+	prefixes [3]byte) {
+	switch {
+	case fix != 0 && n <= fixMax:
+		e.writeByte(fix | byte(n))
+	case prefixes[0] != 0 && n <= math.MaxUint8:
+		e.write(prefixes[0], uint8(n))
+	case n <= math.MaxUint16:
+		e.write(prefixes[1], uint16(n))
+	default:
+		e.write(prefixes[2], uint32(n))
+	}
+}
+
+func (e *msgpackEncoder) writeString(s string) {
+	e.writeLength(len(s), 0xa0, 31, [3]byte{0xd9, 0xda, 0xdb})
+	e.buf.WriteString(s)
+}
+
+func (e *msgpackEncoder) writeInt(i int64) {
+	switch {
+	case i >= 0:
+		e.writeUint(uint64(i))
+	case i >= -32:
+		e.writeByte(byte(i))
+	case i >= math.MinInt8:
+		e.write(0xd0, int8(i))
+	case i >= math.MinInt16:
+		e.write(0xd1, int16(i))
+	case i >= math.MinInt32:
+		e.write(0xd2, int32(i))
+	default:
+		e.write(0xd3, i)
+	}
+}
+
+func (e *msgpackEncoder) writeUint(u uint64) {
+	switch {
+	case u <= 0x7f:
+		e.writeByte(byte(u))
+	case u <= math.MaxUint8:
+		e.write(0xcc, uint8(u))
+	case u <= math.MaxUint16:
+		e.write(0xcd, uint16(u))
+	case u <= math.MaxUint32:
+		e.write(0xce, uint32(u))
+	default:
+		e.write(0xcf, u)
+	}
+}
+
+func (e *msgpackEncoder) encode(v reflect.Value) error {
+	if !v.IsValid() {
+		e.writeByte(0xc0)
+		return nil
+	}
+	if v.Kind() != reflect.Interface && v.CanInterface() &&
+		v.Type().Implements(textMarshalerType) &&
+		(v.Kind() != reflect.Ptr || !v.IsNil()) {
+		text, err := v.Interface().(encoding.TextMarshaler).MarshalText()
+		if err != nil {
+			return err
+		}
+		e.writeString(string(text))
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			e.writeByte(0xc0)
+			return nil
+		}
+		return e.encode(v.Elem())
+	case reflect.Bool:
+		if v.Bool() {
+			e.writeByte(0xc3)
+		} else {
+			e.writeByte(0xc2)
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32,
+		reflect.Int64:
+		e.writeInt(v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32,
+		reflect.Uint64, reflect.Uintptr:
+		e.writeUint(v.Uint())
+	case reflect.Float32:
+		e.write(0xca, float32(v.Float()))
+	case reflect.Float64:
+		e.write(0xcb, v.Float())
+	case reflect.String:
+		e.writeString(v.String())
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			e.writeByte(0xc0)
+			return nil
+		}
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			data := make([]byte, v.Len())
+			reflect.Copy(reflect.ValueOf(data), v)
+			e.writeLength(len(data), 0, 0, [3]byte{0xc4, 0xc5, 0xc6})
+			e.buf.Write(data)
+			return nil
+		}
+		e.writeLength(v.Len(), 0x90, 15, [3]byte{0, 0xdc, 0xdd})
+		for i := 0; i < v.Len(); i++ {
+			if err := e.encode(v.Index(i)); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		if v.IsNil() {
+			e.writeByte(0xc0)
+			return nil
+		}
+		keys := v.MapKeys()
+		sort.Slice(keys, func(i, j int) bool {
+			return fmt.Sprint(keys[i]) < fmt.Sprint(keys[j])
+		})
+		e.writeLength(len(keys), 0x80, 15, [3]byte{0, 0xde, 0xdf})
+		for _, key := range keys {
+			if err := e.encode(key); err != nil {
+				return err
+			}
+			if err := e.encode(v.MapIndex(key)); err != nil {
+				return err
+			}
+		}
+	case reflect.Struct:
+		var fields []msgpackField
+		collectFields(v, &fields)
+		e.writeLength(len(fields), 0x80, 15, [3]byte{0, 0xde, 0xdf})
+		for _, field := range fields {
+			e.writeString(field.name)
+			if err := e.encode(field.value); err != nil {
+				return err
+			}
+		}
+	default:
+		return wherr.NotAcceptable.New("can't render %v as MessagePack",
+			v.Type())
+	}
+	return nil
+}
+
+type msgpackField struct {
+	name  string
+	value reflect.Value
+}
+
+// collectFields gathers the fields of the struct v the way encoding/json
+// would name them, flattening untagged embedded structs.
+func collectFields(v reflect.Value, fields *[]msgpackField) {
+	typ := v.Type()
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		tag := strings.Split(field.Tag.Get("json"), ",")
+		name := tag[0]
+		if name == "-" && len(tag) == 1 {
+			continue
+		}
+		fv := v.Field(i)
+		if name == "" && field.Anonymous {
+			embedded := fv
+			if embedded.Kind() == reflect.Ptr {
+				if embedded.IsNil() {
+					continue
+				}
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct {
+				collectFields(embedded, fields)
+				continue
+			}
+		}
+		if field.PkgPath != "" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		omitEmpty := false
+		for _, opt := range tag[1:] {
+			omitEmpty = omitEmpty || opt == "omitempty"
+		}
+		if omitEmpty && isEmpty(fv) {
+			continue
+		}
+		*fields = append(*fields, msgpackField{name: name, value: fv})
+	}
+}
+
+func isEmpty(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32,
+		reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32,
+		reflect.Uint64, reflect.Uintptr:
+		return v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() == 0
+	case reflect.Interface, reflect.Ptr:
+		return v.IsNil()
+	}
+	return false
+}
@@ -0,0 +1,179 @@
+// Copyright (C) 2017 JT Olds
+// See LICENSE for copying information
+
+// Package whrender renders responses in whichever of a number of formats
+// (JSON, XML, CSV, MessagePack) the client asked for.
+//
+// whrender shares the whjson Encoder (see whjson.EncodeWith) for envelope
+// and error key settings, so switching an API from whjson.Render to
+// whrender.Render only adds formats.
+package whrender // import "gopkg.in/webhelp.v1/whrender"
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"gopkg.in/webhelp.v1/whcompat"
+	"gopkg.in/webhelp.v1/wherr"
+	"gopkg.in/webhelp.v1/whparse"
+)
+
+// Format is a response encoding a Renderer can pick.
+type Format interface {
+	// Name is the value of the format query parameter that selects this
+	// Format, like "json".
+	Name() string
+
+	// ContentTypes lists the media types this Format is selected by in Accept
+	// headers. The first is used as the response Content-Type.
+	ContentTypes() []string
+
+	// Marshal encodes value for r. If the Format can't represent value, it
+	// should return a wherr.NotAcceptable error.
+	Marshal(r *http.Request, value interface{}) ([]byte, error)
+
+	// MarshalError encodes an error response body for err.
+	MarshalError(r *http.Request, err error) ([]byte, error)
+}
+
+var (
+	// DefaultRenderer is the Renderer used by Render and ErrHandler. It
+	// supports JSON (the default), XML, CSV, and MessagePack, selected with
+	// the Accept header or the "format" query parameter.
+	DefaultRenderer = &Renderer{
+		Formats:     []Format{JSON, XML, CSV, MessagePack},
+		FormatParam: "format"}
+
+	// ErrHandler is a wherr.Handler that renders errors with DefaultRenderer.
+	ErrHandler = wherr.HandlerFunc(func(w http.ResponseWriter,
+		r *http.Request, err error) {
+		DefaultRenderer.HandleError(w, r, err)
+	})
+)
+
+// Renderer picks a Format for each request and renders values with it.
+type Renderer struct {
+	// Formats are the supported formats. The first is used when the client
+	// doesn't express a preference, or prefers several formats equally.
+	Formats []Format
+
+	// FormatParam, if set, names a query parameter (like "format") that
+	// selects a Format by name, overriding the Accept header.
+	FormatParam string
+}
+
+// Render renders value with DefaultRenderer.
+func Render(w http.ResponseWriter, r *http.Request, value interface{}) {
+	DefaultRenderer.Render(w, r, value)
+}
+
+// Negotiate returns the Format to use for r. If the format query parameter
+// names an unknown format, or none of the Formats are acceptable, it returns
+// a wherr.NotAcceptable error.
+func (rr *Renderer) Negotiate(r *http.Request) (Format, error) {
+	if len(rr.Formats) == 0 {
+		return nil, wherr.InternalServerError.New("no formats configured")
+	}
+	if rr.FormatParam != "" {
+		if name := r.URL.Query().Get(rr.FormatParam); name != "" {
+			for _, format := range rr.Formats {
+				if strings.EqualFold(format.Name(), name) {
+					return format, nil
+				}
+			}
+			return nil, wherr.NotAcceptable.New("unsupported format %#v", name)
+		}
+	}
+	accept := r.Header.Get("Accept")
+	if accept == "" {
+		return rr.Formats[0], nil
+	}
+	var offers []string
+	formats := map[string]Format{}
+	for _, format := range rr.Formats {
+		for _, contentType := range format.ContentTypes() {
+			if _, exists := formats[contentType]; !exists {
+				offers = append(offers, contentType)
+				formats[contentType] = format
+			}
+		}
+	}
+	contentType, ok := whparse.NegotiateContentType(accept, offers...)
+	if !ok {
+		return nil, wherr.NotAcceptable.New("no supported format in %#v",
+			accept)
+	}
+	return formats[contentType], nil
+}
+
+// Render renders value with the Format Negotiate picks. Errors are handled
+// by the registered wherr.Handler, falling back to the Renderer's own
+// HandleError.
+func (rr *Renderer) Render(w http.ResponseWriter, r *http.Request,
+	value interface{}) {
+	w.Header().Add("Vary", "Accept")
+	format, err := rr.Negotiate(r)
+	if err != nil {
+		rr.handleError(w, r, err)
+		return
+	}
+	data, err := format.Marshal(r, value)
+	if err != nil {
+		rr.handleError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", format.ContentTypes()[0])
+	w.Header().Set("Content-Length", fmt.Sprint(len(data)))
+	w.Write(data)
+}
+
+func (rr *Renderer) handleError(w http.ResponseWriter, r *http.Request,
+	err error) {
+	wherr.AbortIfStarted(w, err)
+	if handler := wherr.HandlingWith(whcompat.Context(r)); handler != nil {
+		handler.HandleError(w, r, err)
+		return
+	}
+	rr.HandleError(w, r, err)
+}
+
+// HandleError implements wherr.Handler. It renders the error with the
+// Format Negotiate picks, or the first Format if none is acceptable, or as
+// plain text if there are no Formats.
+func (rr *Renderer) HandleError(w http.ResponseWriter, r *http.Request,
+	handledErr error) {
+	if !wherr.HasBody(handledErr) {
+		log.Printf("client closed request: %v", handledErr)
+		w.WriteHeader(wherr.StatusCode(handledErr))
+		return
+	}
+	log.Printf("error: %v", handledErr)
+	if len(rr.Formats) == 0 {
+		writePlainError(w, r, handledErr)
+		return
+	}
+	format, err := rr.Negotiate(r)
+	if err != nil {
+		format = rr.Formats[0]
+	}
+	data, err := format.MarshalError(r, handledErr)
+	if err != nil {
+		log.Printf("failed serializing error: %v", handledErr)
+		writePlainError(w, r, handledErr)
+		return
+	}
+	w.Header().Set("Content-Type", format.ContentTypes()[0])
+	w.Header().Set("Content-Length", fmt.Sprint(len(data)))
+	w.WriteHeader(wherr.StatusCode(handledErr))
+	w.Write(data)
+}
+
+func writePlainError(w http.ResponseWriter, r *http.Request, err error) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(wherr.StatusCode(err))
+	fmt.Fprintln(w, wherr.Message(r, err))
+}
+
+var _ wherr.Handler = (*Renderer)(nil)
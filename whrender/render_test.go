@@ -0,0 +1,83 @@
+// Copyright (C) 2017 JT Olds
+// See LICENSE for copying information
+
+package whrender_test
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"gopkg.in/webhelp.v1/wherr"
+	"gopkg.in/webhelp.v1/whrender"
+)
+
+type row struct {
+	ID     int    `json:"id"`
+	Name   string `csv:"full_name"`
+	Secret string `json:"-"`
+}
+
+func TestRender(t *testing.T) {
+	rows := []row{{ID: 1, Name: "jt, olds", Secret: "x"}, {ID: 2}}
+	for _, test := range []struct {
+		url, accept string
+		value       interface{}
+		status      int
+		contentType string
+		body        string
+	}{
+		{"/", "", rows, 200, "application/json", `"Name": "jt, olds"`},
+		{"/", "text/html, application/xml;q=0.9, */*;q=0.8", rows, 200,
+			"application/xml", "<resp>\n  <row>\n    <ID>1</ID>"},
+		{"/?format=csv", "application/json", rows, 200, "text/csv",
+			"id,full_name\n1,\"jt, olds\"\n2,\n"},
+		{"/", "text/csv", map[string]int{"a": 1}, 406, "text/csv",
+			"err,field,code\n"},
+		{"/", "image/png", rows, 406, "application/json", `"err"`},
+		{"/", "application/json;q=0, */*", rows, 200, "application/xml",
+			"<resp>"},
+		{"/?format=yaml", "", rows, 406, "application/json", "yaml"},
+		{"/", "application/x-msgpack", map[string]int{"a": 1}, 200,
+			"application/msgpack", "\x81\xa4resp\x81\xa1a\x01"},
+	} {
+		r := httptest.NewRequest("GET", test.url, nil)
+		if test.accept != "" {
+			r.Header.Set("Accept", test.accept)
+		}
+		w := httptest.NewRecorder()
+		whrender.Render(w, r, test.value)
+		if w.Code != test.status ||
+			w.Header().Get("Content-Type") != test.contentType ||
+			!strings.Contains(w.Body.String(), test.body) {
+			t.Fatalf("%s %q: unexpected response: %d %s %q", test.url,
+				test.accept, w.Code, w.Header().Get("Content-Type"),
+				w.Body.String())
+		}
+	}
+}
+
+func TestMessagePack(t *testing.T) {
+	r := httptest.NewRequest("GET", "/?format=msgpack", nil)
+	w := httptest.NewRecorder()
+	whrender.Render(w, r, []interface{}{
+		nil, true, -1, -200, 300, 1.5, "hi", []byte{1}, row{ID: 1}})
+	expected := "\x81\xa4resp\x99\xc0\xc3\xff\xd1\xff\x38\xcd\x01\x2c" +
+		"\xcb\x3f\xf8\x00\x00\x00\x00\x00\x00\xa2hi\xc4\x01\x01" +
+		"\x82\xa2id\x01\xa4Name\xa0"
+	if !bytes.Equal(w.Body.Bytes(), []byte(expected)) {
+		t.Fatalf("unexpected MessagePack: %q", w.Body.String())
+	}
+}
+
+func TestHandleErrorWithoutFormats(t *testing.T) {
+	w := httptest.NewRecorder()
+	(&whrender.Renderer{}).HandleError(w, httptest.NewRequest("GET", "/", nil),
+		wherr.NotFound.New("no such row"))
+	if w.Code != 404 ||
+		w.Header().Get("Content-Type") != "text/plain; charset=utf-8" {
+		t.Fatalf("unexpected response: %d %s %q", w.Code,
+			w.Header().Get("Content-Type"), w.Body.String())
+	}
+}
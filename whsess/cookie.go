@@ -33,12 +33,23 @@ type CookieOptions struct {
 }
 
 type CookieStore struct {
-	Options  CookieOptions
-	secretCB func(context.Context) ([]byte, error)
+	Options CookieOptions
+
+	// KeepOldSecrets causes sessions opened with an older secret to stay
+	// sealed with it when saved, instead of being resealed with the newest
+	// secret, so that during a rolling deploy, servers that don't have the
+	// newest secret yet can still read them. Turn it back off once every
+	// server has the newest secret: sessions that keep an old secret get a
+	// fresh cookie on every save, so they never expire and would be logged
+	// out when that secret is dropped. New sessions are always sealed with
+	// the newest secret.
+	KeepOldSecrets bool
+
+	secretsCB func(context.Context) ([][]byte, error)
 
 	secretMtx   sync.Mutex
 	secretSetup bool
-	secret      [keyLength]byte
+	secrets     []*[keyLength]byte
 }
 
 var _ Store = (*CookieStore)(nil)
@@ -46,15 +57,21 @@ var _ Store = (*CookieStore)(nil)
 // NewCookieStore creates a secure cookie store with default settings.
 // Configure the Options field further if additional settings are required.
 func NewCookieStore(secretKey []byte) *CookieStore {
-	rv := &CookieStore{
-		Options: CookieOptions{
-			Path:   "/",
-			MaxAge: 86400 * 30},
-		secretCB: func(context.Context) ([]byte, error) {
-			return secretKey, nil
-		},
-	}
-	return rv
+	return NewRotatingCookieStore(secretKey)
+}
+
+// NewRotatingCookieStore is like NewCookieStore but takes a list of secret
+// keys, newest first. Cookies are sealed with the newest key, and opened
+// with whichever key works. Sessions opened with an older key are resealed
+// with the newest one when they're saved, so a secret can be rotated by
+// adding a new one to the front of the list and dropping the oldest once
+// sessions still sealed with it have expired, without logging active users
+// out. See the KeepOldSecrets field for rolling deploys.
+func NewRotatingCookieStore(secretKeys ...[]byte) *CookieStore {
+	return NewLazyRotatingCookieStore(
+		func(context.Context) ([][]byte, error) {
+			return secretKeys, nil
+		})
 }
 
 // NewLazyCookieStore is like NewCookieStore but loads the secretKey using
@@ -63,40 +80,62 @@ func NewCookieStore(secretKey []byte) *CookieStore {
 // with a database without a context.
 func NewLazyCookieStore(secretKey func(context.Context) ([]byte, error)) (
 	cs *CookieStore) {
-	rv := &CookieStore{
+	return NewLazyRotatingCookieStore(
+		func(ctx context.Context) ([][]byte, error) {
+			secret, err := secretKey(ctx)
+			if err != nil {
+				return nil, err
+			}
+			return [][]byte{secret}, nil
+		})
+}
+
+// NewLazyRotatingCookieStore is like NewRotatingCookieStore but loads the
+// secret keys, newest first, using the provided callback once, like
+// NewLazyCookieStore.
+func NewLazyRotatingCookieStore(
+	secretKeys func(context.Context) ([][]byte, error)) *CookieStore {
+	return &CookieStore{
 		Options: CookieOptions{
 			Path:   "/",
 			MaxAge: 86400 * 30},
-		secretCB: secretKey,
+		secretsCB: secretKeys,
 	}
-	return rv
 }
 
-func (cs *CookieStore) getSecret(ctx context.Context) (
-	*[keyLength]byte, error) {
+func (cs *CookieStore) getSecrets(ctx context.Context) (
+	[]*[keyLength]byte, error) {
 	cs.secretMtx.Lock()
 	defer cs.secretMtx.Unlock()
 	if cs.secretSetup {
-		return &cs.secret, nil
+		return cs.secrets, nil
 	}
-	secret, err := cs.secretCB(ctx)
+	secrets, err := cs.secretsCB(ctx)
 	if err != nil {
 		return nil, err
 	}
-	if len(secret) < minKeyLength {
-		return nil, wherr.InternalServerError.New("cookie secret not long enough")
+	if len(secrets) == 0 {
+		return nil, wherr.InternalServerError.New("no cookie secrets")
+	}
+	keys := make([]*[keyLength]byte, 0, len(secrets))
+	for _, secret := range secrets {
+		if len(secret) < minKeyLength {
+			return nil, wherr.InternalServerError.New(
+				"cookie secret not long enough")
+		}
+		key := sha256.Sum256(secret)
+		keys = append(keys, &key)
 	}
-	secretHash := sha256.Sum256(secret)
-	copy(cs.secret[:], secretHash[:])
+	cs.secrets = keys
 	cs.secretSetup = true
-	return &cs.secret, nil
+	return cs.secrets, nil
 }
 
 // Load implements the Store interface. Not expected to be used directly.
 func (cs *CookieStore) Load(ctx context.Context, r *http.Request,
 	namespace string) (rv SessionData, err error) {
 	empty := SessionData{New: true, Values: map[interface{}]interface{}{}}
-	secret, err := cs.getSecret(whcompat.Context(r))
+	secrets, err := cs.getSecrets(whcompat.Context(r))
 	if err != nil {
 		return empty, err
 	}
@@ -105,30 +144,38 @@ func (cs *CookieStore) Load(ctx context.Context, r *http.Request,
 		return empty, nil
 	}
 	data, err := base64.URLEncoding.DecodeString(c.Value)
-	if err != nil {
+	if err != nil || len(data) < nonceLength {
 		return empty, nil
 	}
 	var nonce [nonceLength]byte
 	copy(nonce[:], data[:nonceLength])
-	decrypted, ok := secretbox.Open(nil, data[nonceLength:], &nonce,
-		secret)
-	if !ok {
-		return empty, nil
+	for i, secret := range secrets {
+		decrypted, ok := secretbox.Open(nil, data[nonceLength:], &nonce,
+			secret)
+		if !ok {
+			continue
+		}
+		err = gob.NewDecoder(bytes.NewReader(decrypted)).Decode(&rv.Values)
+		if err != nil {
+			return empty, nil
+		}
+		rv.secretIndex = i
+		return rv, nil
 	}
-	err = gob.NewDecoder(bytes.NewReader(decrypted)).Decode(&rv.Values)
-	if err != nil {
-		return empty, nil
-	}
-	return rv, nil
+	return empty, nil
 }
 
 // Save implements the Store interface. Not expected to be used directly.
 func (cs *CookieStore) Save(ctx context.Context, w http.ResponseWriter,
 	namespace string, s SessionData) error {
-	secret, err := cs.getSecret(ctx)
+	secrets, err := cs.getSecrets(ctx)
 	if err != nil {
 		return err
 	}
+	secret := secrets[0]
+	if cs.KeepOldSecrets && s.secretIndex < len(secrets) {
+		secret = secrets[s.secretIndex]
+	}
 
 	var out bytes.Buffer
 	err = gob.NewEncoder(&out).Encode(&s.Values)
@@ -143,14 +190,7 @@ func (cs *CookieStore) Save(ctx context.Context, w http.ResponseWriter,
 	value := base64.URLEncoding.EncodeToString(
 		secretbox.Seal(nonce[:], out.Bytes(), &nonce, secret))
 
-	return setCookie(w, &http.Cookie{
-		Name:     namespace,
-		Value:    value,
-		Path:     cs.Options.Path,
-		Domain:   cs.Options.Domain,
-		MaxAge:   cs.Options.MaxAge,
-		Secure:   cs.Options.Secure,
-		HttpOnly: cs.Options.HttpOnly})
+	return setCookie(w, cs.Options.cookie(namespace, value))
 }
 
 func setCookie(w http.ResponseWriter, cookie *http.Cookie) error {
@@ -165,12 +205,5 @@ func setCookie(w http.ResponseWriter, cookie *http.Cookie) error {
 // Clear implements the Store interface. Not expected to be used directly.
 func (cs *CookieStore) Clear(ctx context.Context, w http.ResponseWriter,
 	namespace string) error {
-	return setCookie(w, &http.Cookie{
-		Name:     namespace,
-		Value:    "",
-		Path:     cs.Options.Path,
-		Domain:   cs.Options.Domain,
-		MaxAge:   -1,
-		Secure:   cs.Options.Secure,
-		HttpOnly: cs.Options.HttpOnly})
+	return setCookie(w, cs.Options.clearCookie(namespace))
 }
@@ -0,0 +1,46 @@
+// Copyright (C) 2017 JT Olds
+// See LICENSE for copying information
+
+package whsess_test
+
+import (
+	"testing"
+
+	"gopkg.in/webhelp.v1/whsess"
+)
+
+func TestCookieStoreRotation(t *testing.T) {
+	oldKey, newKey := []byte("old secret key"), []byte("new secret key")
+	oldServer := sessionServer(t, whsess.NewCookieStore(oldKey))
+	rotating := whsess.NewRotatingCookieStore(newKey, oldKey)
+	rotatingServer := sessionServer(t, rotating)
+	newServer := sessionServer(t, whsess.NewCookieStore(newKey))
+
+	// sessions sealed with the old key open with the old key, and with
+	// KeepOldSecrets, stay sealed with it.
+	rotating.KeepOldSecrets = true
+	cookie := get(oldServer, "/", nil)
+	cookie, count := getCount(rotatingServer, "/", cookie)
+	if count != "2" {
+		t.Fatalf("old session not opened, count %s", count)
+	}
+	if _, count := getCount(oldServer, "/", cookie); count != "3" {
+		t.Fatalf("session resealed, count %s", count)
+	}
+
+	// by default, they move to the new key.
+	rotating.KeepOldSecrets = false
+	cookie, _ = getCount(rotatingServer, "/", cookie)
+	if _, count := getCount(oldServer, "/", cookie); count != "1" {
+		t.Fatalf("session not resealed, count %s", count)
+	}
+	if _, count := getCount(newServer, "/", cookie); count != "4" {
+		t.Fatalf("resealed session not opened, count %s", count)
+	}
+
+	// new sessions use the newest key.
+	cookie = get(rotatingServer, "/", nil)
+	if _, count := getCount(newServer, "/", cookie); count != "2" {
+		t.Fatalf("new session not sealed with newest key, count %s", count)
+	}
+}
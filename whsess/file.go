@@ -0,0 +1,301 @@
+// Copyright (C) 2017 JT Olds
+// See LICENSE for copying information
+
+package whsess
+
+import (
+	"bytes"
+	"encoding/gob"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+const (
+	fileLockName  = ".lock"
+	fileTmpPrefix = ".tmp-"
+
+	// staleTmpAge is how old a temporary file has to be before the sweeper
+	// assumes its writer crashed.
+	staleTmpAge = 10 * time.Minute
+)
+
+type fileSession struct {
+	Namespace string
+	Created   time.Time
+	Values    []byte
+}
+
+// FileStore is a server-side Store that keeps session data in files under a
+// directory and only a random session ID in the cookie. Sessions survive
+// restarts, but the directory shouldn't be shared between hosts.
+//
+// Files are written to a temporary file and renamed into place, so readers
+// never see partial writes. Changes are serialized with a lock file in the
+// directory, which is an flock(2) lock on Unix systems, so multiple
+// processes can share a directory there. Elsewhere, only goroutines within
+// one process are serialized.
+//
+// Like with CookieStore, Values are gob encoded, so custom types need to be
+// registered with gob.Register.
+type FileStore struct {
+	// Options configure the session ID cookie.
+	Options CookieOptions
+
+	dir     string
+	expiry  expiry
+	now     func() time.Time
+	mtx     sync.Mutex
+	lock    *os.File
+	sweeper *sweeper
+}
+
+var _ Store = (*FileStore)(nil)
+
+// NewFileStore creates a FileStore keeping sessions in dir, which is created
+// if it doesn't exist. Expiry works like with NewMemoryStore: sessions
+// expire after idleTimeout without being loaded or saved, or maxLifetime
+// after they were created, and either may be zero for no limit.
+//
+// Unless both are zero, NewFileStore starts a goroutine that periodically
+// removes expired session files. Call Close to stop it.
+func NewFileStore(dir string, idleTimeout, maxLifetime time.Duration) (
+	*FileStore, error) {
+	err := os.MkdirAll(dir, 0700)
+	if err != nil {
+		return nil, SessionError.Wrap(err)
+	}
+	lock, err := os.OpenFile(filepath.Join(dir, fileLockName),
+		os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, SessionError.Wrap(err)
+	}
+	fs := &FileStore{
+		Options: serverCookieOptions(maxLifetime),
+		dir:     dir,
+		expiry:  expiry{idle: idleTimeout, max: maxLifetime},
+		now:     time.Now,
+		lock:    lock}
+	if idleTimeout > 0 || maxLifetime > 0 {
+		fs.sweeper = startSweeper(fs.expiry.sweepInterval(), fs.sweep)
+	}
+	return fs, nil
+}
+
+// Close stops the background goroutine that removes expired sessions,
+// waiting for it to exit, and closes the lock file. The store shouldn't be
+// used afterwards. It is safe to call Close more than once.
+func (fs *FileStore) Close() error {
+	if fs.sweeper != nil {
+		fs.sweeper.Stop()
+	}
+	fs.mtx.Lock()
+	defer fs.mtx.Unlock()
+	if fs.lock == nil {
+		return nil
+	}
+	err := fs.lock.Close()
+	fs.lock = nil
+	return err
+}
+
+// locked runs fn while holding both the in-process and the file lock.
+func (fs *FileStore) locked(fn func() error) error {
+	fs.mtx.Lock()
+	defer fs.mtx.Unlock()
+	if fs.lock == nil {
+		return SessionError.New("file store closed")
+	}
+	err := lockFile(fs.lock)
+	if err != nil {
+		return SessionError.Wrap(err)
+	}
+	defer unlockFile(fs.lock)
+	return fn()
+}
+
+// path returns the file for session id. Session IDs come from clients, so
+// anything that doesn't look like one of ours is refused, which keeps paths
+// inside the directory.
+func (fs *FileStore) path(id string) (string, bool) {
+	if !validSessionID(id) {
+		return "", false
+	}
+	return filepath.Join(fs.dir, id), true
+}
+
+// read returns the session stored at path if it exists and hasn't expired.
+func (fs *FileStore) read(path string, now time.Time) (*fileSession, bool) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, false
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, false
+	}
+	var session fileSession
+	err = gob.NewDecoder(bytes.NewReader(data)).Decode(&session)
+	if err != nil ||
+		fs.expiry.expired(session.Created, info.ModTime(), now) {
+		return &session, false
+	}
+	return &session, true
+}
+
+// removeIfExpired removes the session file at path if it has expired or is
+// corrupt, checking again under the lock so a concurrent Save isn't undone.
+func (fs *FileStore) removeIfExpired(path string) error {
+	return fs.locked(func() error {
+		if _, ok := fs.read(path, fs.now()); ok {
+			return nil
+		}
+		err := os.Remove(path)
+		if err != nil && !os.IsNotExist(err) {
+			return SessionError.Wrap(err)
+		}
+		return nil
+	})
+}
+
+func (fs *FileStore) sweep(now time.Time) {
+	infos, err := ioutil.ReadDir(fs.dir)
+	if err != nil {
+		return
+	}
+	for _, info := range infos {
+		name := info.Name()
+		switch {
+		case strings.HasPrefix(name, fileTmpPrefix):
+			if now.Sub(info.ModTime()) > staleTmpAge {
+				os.Remove(filepath.Join(fs.dir, name))
+			}
+		case validSessionID(name):
+			path := filepath.Join(fs.dir, name)
+			if _, ok := fs.read(path, now); !ok {
+				fs.removeIfExpired(path)
+			}
+		}
+	}
+}
+
+// Load implements the Store interface. Not expected to be used directly.
+func (fs *FileStore) Load(ctx context.Context, r *http.Request,
+	namespace string) (rv SessionData, err error) {
+	id, ok := requestSessionID(r, namespace)
+	if !ok {
+		return newSession()
+	}
+	path, _ := fs.path(id)
+	now := fs.now()
+	session, ok := fs.read(path, now)
+	if !ok {
+		if session != nil {
+			fs.removeIfExpired(path)
+		}
+		return newSession()
+	}
+	if session.Namespace != namespace {
+		return newSession()
+	}
+	values, err := decodeValues(session.Values)
+	if err != nil {
+		return newSession()
+	}
+	// the modification time is the last access time.
+	os.Chtimes(path, now, now)
+	return SessionData{Values: values, id: id}, nil
+}
+
+// Save implements the Store interface. Not expected to be used directly.
+func (fs *FileStore) Save(ctx context.Context, w http.ResponseWriter,
+	namespace string, s SessionData) error {
+	path, ok := fs.path(s.id)
+	if !ok {
+		return SessionError.New("session wasn't loaded from this store")
+	}
+	values, err := encodeValues(s.Values)
+	if err != nil {
+		return err
+	}
+
+	err = fs.locked(func() error {
+		now := fs.now()
+		session, ok := fs.read(path, now)
+		if !ok || session.Namespace != namespace {
+			session = &fileSession{Namespace: namespace, Created: now}
+		}
+		session.Values = values
+		return fs.write(path, session)
+	})
+	if err != nil {
+		return err
+	}
+	return setCookie(w, fs.Options.cookie(namespace, s.id))
+}
+
+// write atomically replaces path with session by writing a temporary file
+// and renaming it into place.
+func (fs *FileStore) write(path string, session *fileSession) (err error) {
+	var data bytes.Buffer
+	err = gob.NewEncoder(&data).Encode(session)
+	if err != nil {
+		return SessionError.Wrap(err)
+	}
+	tmp, err := ioutil.TempFile(fs.dir, fileTmpPrefix)
+	if err != nil {
+		return SessionError.Wrap(err)
+	}
+	defer func() {
+		if err != nil {
+			tmp.Close()
+			os.Remove(tmp.Name())
+		}
+	}()
+	_, err = tmp.Write(data.Bytes())
+	if err != nil {
+		return SessionError.Wrap(err)
+	}
+	err = tmp.Sync()
+	if err != nil {
+		return SessionError.Wrap(err)
+	}
+	err = tmp.Close()
+	if err != nil {
+		return SessionError.Wrap(err)
+	}
+	err = os.Rename(tmp.Name(), path)
+	if err != nil {
+		return SessionError.Wrap(err)
+	}
+	return nil
+}
+
+// Clear implements the Store interface. Not expected to be used directly.
+func (fs *FileStore) Clear(ctx context.Context, w http.ResponseWriter,
+	namespace string) error {
+	if id, ok := loadedSessionID(ctx, namespace); ok {
+		path, _ := fs.path(id)
+		err := fs.locked(func() error {
+			session, _ := fs.read(path, fs.now())
+			if session == nil || session.Namespace != namespace {
+				return nil
+			}
+			err := os.Remove(path)
+			if err != nil && !os.IsNotExist(err) {
+				return SessionError.Wrap(err)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return setCookie(w, fs.Options.clearCookie(namespace))
+}
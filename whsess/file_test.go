@@ -0,0 +1,69 @@
+// Copyright (C) 2017 JT Olds
+// See LICENSE for copying information
+
+package whsess_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"gopkg.in/webhelp.v1/whsess"
+)
+
+func TestFileStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "whsess")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	store, err := whsess.NewFileStore(dir, 100*time.Millisecond, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := sessionServer(t, store)
+
+	first := get(h, "/", nil)
+	if first == nil || first.MaxAge != 0 {
+		t.Fatalf("unexpected cookie: %v", first)
+	}
+	path := filepath.Join(dir, first.Value)
+	if _, err := os.Stat(path); err != nil {
+		t.Fatalf("session file missing: %v", err)
+	}
+
+	// a new store on the same directory sees existing sessions.
+	store.Close()
+	store, err = whsess.NewFileStore(dir, 100*time.Millisecond, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	h = sessionServer(t, store)
+	if c := get(h, "/", first); c.Value != first.Value {
+		t.Fatalf("session lost across stores")
+	}
+
+	forged := &http.Cookie{Name: "test", Value: "../" + first.Value}
+	if c := get(h, "/", forged); c.Value == forged.Value {
+		t.Fatalf("forged session ID accepted")
+	}
+
+	cleared := get(h, "/?clear=1", first)
+	if _, err := os.Stat(path); !os.IsNotExist(err) || cleared.MaxAge >= 0 {
+		t.Fatalf("session not cleared: %v", err)
+	}
+
+	idle := get(h, "/", nil)
+	time.Sleep(200 * time.Millisecond)
+	if c := get(h, "/", idle); c.Value == idle.Value {
+		t.Fatalf("idle session not expired")
+	}
+	if _, err := os.Stat(filepath.Join(dir, idle.Value)); !os.IsNotExist(err) {
+		t.Fatalf("expired session file not removed: %v", err)
+	}
+}
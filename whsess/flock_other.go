@@ -0,0 +1,16 @@
+// Copyright (C) 2017 JT Olds
+// See LICENSE for copying information
+
+// +build appengine !darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd
+
+package whsess
+
+import (
+	"os"
+)
+
+// Without flock, FileStore only serializes goroutines within one process.
+
+func lockFile(f *os.File) error { return nil }
+
+func unlockFile(f *os.File) error { return nil }
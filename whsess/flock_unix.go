@@ -0,0 +1,20 @@
+// Copyright (C) 2017 JT Olds
+// See LICENSE for copying information
+
+// +build !appengine
+// +build darwin dragonfly freebsd linux netbsd openbsd
+
+package whsess
+
+import (
+	"os"
+	"syscall"
+)
+
+func lockFile(f *os.File) error {
+	return syscall.Flock(int(f.Fd()), syscall.LOCK_EX)
+}
+
+func unlockFile(f *os.File) error {
+	return syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+}
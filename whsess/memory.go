@@ -0,0 +1,185 @@
+// Copyright (C) 2017 JT Olds
+// See LICENSE for copying information
+
+package whsess
+
+import (
+	"hash/fnv"
+	"net/http"
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+const memoryShards = 32
+
+type memorySession struct {
+	namespace         string
+	values            []byte
+	created, accessed time.Time
+}
+
+type memoryShard struct {
+	mtx      sync.Mutex
+	sessions map[string]*memorySession
+}
+
+// MemoryStore is a server-side Store that keeps session data in memory and
+// only a random session ID in the cookie, so sessions can be revoked and
+// aren't limited by cookie size. Session data is lost when the process
+// exits and isn't shared between processes.
+//
+// Values are gob encoded on Save, like with CookieStore, so custom types
+// need to be registered with gob.Register, and changing Values after Save
+// doesn't change the stored session.
+type MemoryStore struct {
+	// Options configure the session ID cookie.
+	Options CookieOptions
+
+	expiry  expiry
+	now     func() time.Time
+	shards  [memoryShards]memoryShard
+	sweeper *sweeper
+}
+
+var _ Store = (*MemoryStore)(nil)
+
+// NewMemoryStore creates a MemoryStore. Sessions expire when they haven't
+// been loaded or saved for idleTimeout, or when they're older than
+// maxLifetime, whichever comes first. Either may be zero for no limit. The
+// cookie's MaxAge defaults to maxLifetime.
+//
+// Unless both are zero, NewMemoryStore starts a goroutine that periodically
+// removes expired sessions. Call Close to stop it.
+func NewMemoryStore(idleTimeout, maxLifetime time.Duration) *MemoryStore {
+	ms := &MemoryStore{
+		Options: serverCookieOptions(maxLifetime),
+		expiry:  expiry{idle: idleTimeout, max: maxLifetime},
+		now:     time.Now}
+	for i := range ms.shards {
+		ms.shards[i].sessions = map[string]*memorySession{}
+	}
+	if idleTimeout > 0 || maxLifetime > 0 {
+		ms.sweeper = startSweeper(ms.expiry.sweepInterval(), ms.sweep)
+	}
+	return ms
+}
+
+// Close stops the background goroutine that removes expired sessions,
+// waiting for it to exit. The store keeps working, but expired sessions are
+// only removed when they're loaded. It is safe to call Close more than once.
+func (ms *MemoryStore) Close() error {
+	if ms.sweeper != nil {
+		ms.sweeper.Stop()
+	}
+	return nil
+}
+
+func (ms *MemoryStore) shard(id string) *memoryShard {
+	h := fnv.New32a()
+	h.Write([]byte(id))
+	return &ms.shards[h.Sum32()%memoryShards]
+}
+
+func (ms *MemoryStore) sweep(now time.Time) {
+	for i := range ms.shards {
+		shard := &ms.shards[i]
+		shard.mtx.Lock()
+		for id, session := range shard.sessions {
+			if ms.expiry.expired(session.created, session.accessed, now) {
+				delete(shard.sessions, id)
+			}
+		}
+		shard.mtx.Unlock()
+	}
+}
+
+// Len returns the number of stored sessions, including expired sessions
+// that haven't been removed yet.
+func (ms *MemoryStore) Len() (n int) {
+	for i := range ms.shards {
+		shard := &ms.shards[i]
+		shard.mtx.Lock()
+		n += len(shard.sessions)
+		shard.mtx.Unlock()
+	}
+	return n
+}
+
+// Load implements the Store interface. Not expected to be used directly.
+func (ms *MemoryStore) Load(ctx context.Context, r *http.Request,
+	namespace string) (rv SessionData, err error) {
+	id, ok := requestSessionID(r, namespace)
+	if !ok {
+		return newSession()
+	}
+	data, ok := ms.get(id, namespace)
+	if !ok {
+		return newSession()
+	}
+	values, err := decodeValues(data)
+	if err != nil {
+		return newSession()
+	}
+	return SessionData{Values: values, id: id}, nil
+}
+
+func (ms *MemoryStore) get(id, namespace string) ([]byte, bool) {
+	shard := ms.shard(id)
+	shard.mtx.Lock()
+	defer shard.mtx.Unlock()
+	session, exists := shard.sessions[id]
+	if !exists || session.namespace != namespace {
+		return nil, false
+	}
+	now := ms.now()
+	if ms.expiry.expired(session.created, session.accessed, now) {
+		delete(shard.sessions, id)
+		return nil, false
+	}
+	session.accessed = now
+	return session.values, true
+}
+
+// Save implements the Store interface. Not expected to be used directly.
+func (ms *MemoryStore) Save(ctx context.Context, w http.ResponseWriter,
+	namespace string, s SessionData) error {
+	if s.id == "" {
+		return SessionError.New("session wasn't loaded from this store")
+	}
+	data, err := encodeValues(s.Values)
+	if err != nil {
+		return err
+	}
+
+	shard := ms.shard(s.id)
+	shard.mtx.Lock()
+	now := ms.now()
+	session, exists := shard.sessions[s.id]
+	if !exists || session.namespace != namespace ||
+		ms.expiry.expired(session.created, session.accessed, now) {
+		session = &memorySession{namespace: namespace, created: now}
+		shard.sessions[s.id] = session
+	}
+	session.values = data
+	session.accessed = now
+	shard.mtx.Unlock()
+
+	return setCookie(w, ms.Options.cookie(namespace, s.id))
+}
+
+// Clear implements the Store interface. Not expected to be used directly.
+func (ms *MemoryStore) Clear(ctx context.Context, w http.ResponseWriter,
+	namespace string) error {
+	if id, ok := loadedSessionID(ctx, namespace); ok {
+		shard := ms.shard(id)
+		shard.mtx.Lock()
+		if session, exists := shard.sessions[id]; exists &&
+			session.namespace == namespace {
+			delete(shard.sessions, id)
+		}
+		shard.mtx.Unlock()
+	}
+	return setCookie(w, ms.Options.clearCookie(namespace))
+}
@@ -0,0 +1,102 @@
+// Copyright (C) 2017 JT Olds
+// See LICENSE for copying information
+
+package whsess_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"gopkg.in/webhelp.v1/whcompat"
+	"gopkg.in/webhelp.v1/whsess"
+)
+
+// sessionServer returns a handler that counts requests in the "test"
+// session in the X-Count response header, clearing the session instead if
+// the clear query parameter is set.
+func sessionServer(t *testing.T, store whsess.Store) http.Handler {
+	return whsess.HandlerWithStore(store, http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			ctx := whcompat.Context(r)
+			sess, err := whsess.Load(ctx, "test")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if r.URL.Query().Get("clear") != "" {
+				err = sess.Clear(ctx, w)
+			} else {
+				count, _ := sess.Values["count"].(int)
+				sess.Values["count"] = count + 1
+				w.Header().Set("X-Count", strconv.Itoa(count+1))
+				err = sess.Save(ctx, w)
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+		}))
+}
+
+// get makes a request with cookie, returning the new cookie, if any, or the
+// old one.
+func get(h http.Handler, url string, cookie *http.Cookie) *http.Cookie {
+	cookie, _ = getCount(h, url, cookie)
+	return cookie
+}
+
+// getCount is like get but also returns the X-Count header.
+func getCount(h http.Handler, url string, cookie *http.Cookie) (
+	*http.Cookie, string) {
+	r := httptest.NewRequest("GET", url, nil)
+	if cookie != nil {
+		r.AddCookie(cookie)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	resp := http.Response{Header: w.Header()}
+	for _, c := range resp.Cookies() {
+		if c.Name == "test" {
+			return c, w.Header().Get("X-Count")
+		}
+	}
+	return cookie, w.Header().Get("X-Count")
+}
+
+func TestMemoryStore(t *testing.T) {
+	store := whsess.NewMemoryStore(100*time.Millisecond, time.Hour)
+	defer store.Close()
+	h := sessionServer(t, store)
+
+	first := get(h, "/", nil)
+	if first == nil || !first.HttpOnly || first.MaxAge != 3600 {
+		t.Fatalf("unexpected cookie: %v", first)
+	}
+	second, count := getCount(h, "/", first)
+	if second.Value != first.Value || count != "2" || store.Len() != 1 {
+		t.Fatalf("session ID changed")
+	}
+
+	forged := &http.Cookie{Name: "test", Value: "../../etc/passwd"}
+	if c := get(h, "/", forged); c.Value == forged.Value || store.Len() != 2 {
+		t.Fatalf("forged session ID accepted")
+	}
+
+	cleared := get(h, "/?clear=1", first)
+	if cleared.MaxAge >= 0 || store.Len() != 1 {
+		t.Fatalf("session not cleared: %v", cleared)
+	}
+	if c := get(h, "/", first); c.Value == first.Value {
+		t.Fatalf("cleared session resumed")
+	}
+
+	idle := get(h, "/", nil)
+	time.Sleep(200 * time.Millisecond)
+	if c := get(h, "/", idle); c.Value == idle.Value {
+		t.Fatalf("idle session not expired")
+	}
+
+	store.Close()
+	store.Close()
+}
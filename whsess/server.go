@@ -0,0 +1,179 @@
+// Copyright (C) 2017 JT Olds
+// See LICENSE for copying information
+
+package whsess
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/gob"
+	"net/http"
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// Server-side stores keep session data on the server and only put a random
+// session ID in the cookie. The helpers in this file are shared between
+// them.
+
+const idLength = 32
+
+// newSessionID returns a new random session ID.
+func newSessionID() (string, error) {
+	var id [idLength]byte
+	_, err := rand.Read(id[:])
+	if err != nil {
+		return "", SessionError.Wrap(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(id[:]), nil
+}
+
+// validSessionID returns true if id looks like something newSessionID
+// returned. Since IDs come from clients, this must be checked before they're
+// used as map keys or file names.
+func validSessionID(id string) bool {
+	data, err := base64.RawURLEncoding.DecodeString(id)
+	return err == nil && len(data) == idLength &&
+		base64.RawURLEncoding.EncodeToString(data) == id
+}
+
+// requestSessionID returns the valid session ID in r's cookie for namespace,
+// if there is one.
+func requestSessionID(r *http.Request, namespace string) (string, bool) {
+	c, err := r.Cookie(namespace)
+	if err != nil || !validSessionID(c.Value) {
+		return "", false
+	}
+	return c.Value, true
+}
+
+// loadedSessionID returns the ID of the session loaded for namespace in ctx,
+// falling back to the request's cookie, for Store.Clear, which isn't given
+// the session.
+func loadedSessionID(ctx context.Context, namespace string) (string, bool) {
+	rc, ok := ctx.Value(reqCtxKey).(*reqCtx)
+	if !ok {
+		return "", false
+	}
+	if session, exists := rc.cache[namespace]; exists && session.id != "" {
+		return session.id, true
+	}
+	return requestSessionID(rc.r, namespace)
+}
+
+// newSession returns empty SessionData with a fresh ID.
+func newSession() (SessionData, error) {
+	id, err := newSessionID()
+	if err != nil {
+		return SessionData{}, err
+	}
+	return SessionData{
+		New:    true,
+		Values: map[interface{}]interface{}{},
+		id:     id}, nil
+}
+
+func (o CookieOptions) cookie(namespace, value string) *http.Cookie {
+	return &http.Cookie{
+		Name:     namespace,
+		Value:    value,
+		Path:     o.Path,
+		Domain:   o.Domain,
+		MaxAge:   o.MaxAge,
+		Secure:   o.Secure,
+		HttpOnly: o.HttpOnly}
+}
+
+func (o CookieOptions) clearCookie(namespace string) *http.Cookie {
+	c := o.cookie(namespace, "")
+	c.MaxAge = -1
+	return c
+}
+
+// serverCookieOptions returns the default cookie options for a server-side
+// store whose sessions last at most maxLifetime.
+func serverCookieOptions(maxLifetime time.Duration) CookieOptions {
+	return CookieOptions{
+		Path:     "/",
+		MaxAge:   int(maxLifetime / time.Second),
+		HttpOnly: true}
+}
+
+// expiry describes when server-side sessions expire.
+type expiry struct {
+	idle, max time.Duration
+}
+
+func (e expiry) expired(created, accessed, now time.Time) bool {
+	return (e.idle > 0 && now.Sub(accessed) > e.idle) ||
+		(e.max > 0 && now.Sub(created) > e.max)
+}
+
+// sweepInterval returns how often expired sessions should be looked for.
+func (e expiry) sweepInterval() time.Duration {
+	interval := e.idle
+	if interval <= 0 || (e.max > 0 && e.max < interval) {
+		interval = e.max
+	}
+	interval /= 2
+	if interval < time.Second {
+		interval = time.Second
+	}
+	return interval
+}
+
+func encodeValues(values map[interface{}]interface{}) ([]byte, error) {
+	var out bytes.Buffer
+	err := gob.NewEncoder(&out).Encode(&values)
+	if err != nil {
+		return nil, SessionError.Wrap(err)
+	}
+	return out.Bytes(), nil
+}
+
+func decodeValues(data []byte) (map[interface{}]interface{}, error) {
+	var values map[interface{}]interface{}
+	err := gob.NewDecoder(bytes.NewReader(data)).Decode(&values)
+	if err != nil {
+		return nil, SessionError.Wrap(err)
+	}
+	if values == nil {
+		values = map[interface{}]interface{}{}
+	}
+	return values, nil
+}
+
+// sweeper calls sweep every interval until stopped.
+type sweeper struct {
+	once sync.Once
+	stop chan struct{}
+	done chan struct{}
+}
+
+func startSweeper(interval time.Duration, sweep func(now time.Time)) *sweeper {
+	s := &sweeper{stop: make(chan struct{}), done: make(chan struct{})}
+	go func() {
+		defer close(s.done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-s.stop:
+				return
+			case now := <-ticker.C:
+				sweep(now)
+			}
+		}
+	}()
+	return s
+}
+
+// Stop stops the sweeper and waits for any sweep in progress to finish. It
+// is safe to call more than once.
+func (s *sweeper) Stop() {
+	s.once.Do(func() { close(s.stop) })
+	<-s.done
+}
@@ -27,6 +27,12 @@ var (
 type SessionData struct {
 	New    bool
 	Values map[interface{}]interface{}
+
+	// id is the session ID for server-side stores.
+	id string
+
+	// secretIndex is which of CookieStore's secrets opened the session.
+	secretIndex int
 }
 
 type Session struct {
@@ -105,5 +111,12 @@ func (s *Session) Clear(ctx context.Context, w http.ResponseWriter) error {
 	for name := range s.Values {
 		delete(s.Values, name)
 	}
-	return s.store.Clear(ctx, w, s.namespace)
+	err := s.store.Clear(ctx, w, s.namespace)
+	if err == nil && s.id != "" {
+		// server-side sessions get a new ID so the cleared one can't be
+		// resumed by saving again.
+		s.id, err = newSessionID()
+		s.New = true
+	}
+	return err
 }
@@ -0,0 +1,287 @@
+// Copyright (C) 2017 JT Olds
+// See LICENSE for copying information
+
+// Package whupload streams multipart/form-data file uploads to a handler
+// provided sink, instead of buffering them into memory or temporary files the
+// way http.Request.ParseMultipartForm does. Uploads are checked against size
+// limits, a maximum file count, and allowed content types as they stream.
+package whupload // import "gopkg.in/webhelp.v1/whupload"
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"strings"
+
+	"gopkg.in/webhelp.v1/wherr"
+)
+
+var (
+	// DefaultUploader is the Uploader used by Process and MustProcess. It
+	// allows up to 10 files of up to 10 MiB each, 32 MiB of files in total,
+	// and any content type.
+	DefaultUploader = Uploader{
+		MaxFileSize:  10 << 20,
+		MaxTotalSize: 32 << 20,
+		MaxFiles:     10}
+
+	errTooLarge = errors.New("upload too large")
+)
+
+// sniffLen is how much of each file is read up front to detect its content
+// type. It's the most http.DetectContentType considers.
+const sniffLen = 512
+
+// File describes an uploaded file.
+type File struct {
+	// FieldName is the name of the form field the file was uploaded as.
+	FieldName string
+
+	// FileName is the file name the client sent. It's untrusted and shouldn't
+	// be used as a path without cleaning it up.
+	FileName string
+
+	// DeclaredType is the media type from the part's Content-Type header, if
+	// any.
+	DeclaredType string
+
+	// ContentType is the media type detected from the file's contents (see
+	// http.DetectContentType), without parameters like charset.
+	ContentType string
+
+	// Header is the part's full MIME header.
+	Header textproto.MIMEHeader
+}
+
+// Sink consumes an uploaded file. It's called once per file, in the order the
+// files appear in the request, and should read the file's contents from body
+// before returning. Reads from body fail once a size limit is exceeded, and
+// anything a Sink doesn't read is discarded, though it still counts toward
+// the limits.
+type Sink func(file *File, body io.Reader) error
+
+// Uploader processes multipart/form-data requests. All errors it returns for
+// bad requests are wherr errors suitable for wherr.Handle.
+type Uploader struct {
+	// MaxFileSize is the largest allowed file, in bytes. MaxTotalSize is the
+	// largest allowed total size of all files. Zero or less means no limit.
+	// Exceeding either results in a wherr.RequestEntityTooLarge error.
+	MaxFileSize, MaxTotalSize int64
+
+	// MaxFiles is the most files allowed in one request. Zero or less means
+	// no limit. Exceeding it results in a wherr.RequestEntityTooLarge error.
+	MaxFiles int
+
+	// MaxFormSize is the largest allowed total size of the non-file form
+	// values, in bytes. Zero means 1 MiB, and less than zero means no limit.
+	MaxFormSize int64
+
+	// AllowedTypes lists the media types files may have, like "image/png",
+	// or wildcards like "image/*". Types are detected from the file contents,
+	// not the declared Content-Type, so for instance JSON and CSV files are
+	// detected as "text/plain", and unrecognized binary files as
+	// "application/octet-stream". Files of other types result in a
+	// wherr.UnsupportedMediaType error. If AllowedTypes is empty, any type
+	// is allowed.
+	AllowedTypes []string
+}
+
+// Process processes r with DefaultUploader.
+func Process(r *http.Request, sink Sink) (url.Values, error) {
+	return DefaultUploader.Process(r, sink)
+}
+
+// MustProcess is like Process but panics with the error. Meant to be used
+// with whfatal.Catch, which will hand the error to wherr.Handle.
+func MustProcess(r *http.Request, sink Sink) url.Values {
+	return DefaultUploader.MustProcess(r, sink)
+}
+
+// MustProcess is like Process but panics with the error. Meant to be used
+// with whfatal.Catch, which will hand the error to wherr.Handle.
+func (u Uploader) MustProcess(r *http.Request, sink Sink) url.Values {
+	vals, err := u.Process(r, sink)
+	if err != nil {
+		if !wherr.HTTPError.Contains(err) {
+			err = wherr.InternalServerError.Wrap(err)
+		}
+		panic(err)
+	}
+	return vals
+}
+
+// Process reads the multipart/form-data body of r, handing each file to sink
+// and returning the other form values. Processing stops at the first error.
+// Errors returned by sink are returned as is, so files sink already consumed
+// may need cleaning up by the caller.
+func (u Uploader) Process(r *http.Request, sink Sink) (url.Values, error) {
+	mr, err := r.MultipartReader()
+	if err != nil {
+		return nil, wherr.UnsupportedMediaType.New(
+			"expected a multipart/form-data request: %v", err)
+	}
+
+	maxFormSize := u.MaxFormSize
+	if maxFormSize == 0 {
+		maxFormSize = 1 << 20
+	}
+	vals := url.Values{}
+	form := &limitedReader{remaining: maxFormSize}
+	total := &limitedReader{remaining: u.MaxTotalSize}
+	files := 0
+
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			return vals, nil
+		}
+		if err != nil {
+			return nil, wherr.BadRequest.New(
+				"malformed multipart body: %v", err)
+		}
+
+		if part.FileName() == "" {
+			form.r = part
+			value, err := ioutil.ReadAll(form)
+			if form.exceeded {
+				return nil, wherr.RequestEntityTooLarge.New(
+					"form values larger than %d bytes", maxFormSize)
+			}
+			if err != nil {
+				return nil, wherr.BadRequest.New(
+					"malformed multipart body: %v", err)
+			}
+			vals.Add(part.FormName(), string(value))
+			continue
+		}
+
+		files++
+		if u.MaxFiles > 0 && files > u.MaxFiles {
+			return nil, wherr.RequestEntityTooLarge.New(
+				"too many files, at most %d allowed", u.MaxFiles)
+		}
+		err = u.processFile(part, total, sink)
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (u Uploader) processFile(part *multipart.Part, total *limitedReader,
+	sink Sink) error {
+	// file limits apply to what's read from the part, total limits apply to
+	// what's read from every part.
+	total.r = part
+	body := &limitedReader{r: total, remaining: u.MaxFileSize}
+
+	head := make([]byte, sniffLen)
+	n, err := io.ReadFull(body, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return u.readError(part, body, total, err)
+	}
+	head = head[:n]
+
+	file := &File{
+		FieldName:   part.FormName(),
+		FileName:    part.FileName(),
+		ContentType: mediaType(http.DetectContentType(head)),
+		Header:      part.Header}
+	if declared := part.Header.Get("Content-Type"); declared != "" {
+		file.DeclaredType = mediaType(declared)
+	}
+	if !u.allowed(file.ContentType) {
+		return wherr.UnsupportedMediaType.New(
+			"file %#v has unsupported content type %#v", file.FileName,
+			file.ContentType)
+	}
+
+	err = sink(file, io.MultiReader(bytes.NewReader(head), body))
+	if body.exceeded || total.exceeded {
+		return u.readError(part, body, total, err)
+	}
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(ioutil.Discard, body)
+	if err != nil {
+		return u.readError(part, body, total, err)
+	}
+	return nil
+}
+
+func (u Uploader) readError(part *multipart.Part, body,
+	total *limitedReader, err error) error {
+	switch {
+	case body.exceeded:
+		return wherr.RequestEntityTooLarge.New(
+			"file %#v larger than %d bytes", part.FileName(), u.MaxFileSize)
+	case total.exceeded:
+		return wherr.RequestEntityTooLarge.New(
+			"files larger than %d bytes in total", u.MaxTotalSize)
+	}
+	return wherr.BadRequest.New("malformed multipart body: %v", err)
+}
+
+func (u Uploader) allowed(contentType string) bool {
+	if len(u.AllowedTypes) == 0 {
+		return true
+	}
+	for _, allowed := range u.AllowedTypes {
+		allowed = strings.ToLower(allowed)
+		if allowed == contentType || allowed == "*/*" ||
+			(strings.HasSuffix(allowed, "/*") &&
+				strings.HasPrefix(contentType, allowed[:len(allowed)-1])) {
+			return true
+		}
+	}
+	return false
+}
+
+func mediaType(contentType string) string {
+	mt, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return strings.ToLower(strings.TrimSpace(
+			strings.Split(contentType, ";")[0]))
+	}
+	return mt
+}
+
+// limitedReader reads from r until more than remaining bytes have been read,
+// after which it returns errTooLarge. Unlike io.LimitedReader, it
+// distinguishes hitting the limit from reaching the end of r. A remaining
+// value of zero or less means no limit.
+type limitedReader struct {
+	r         io.Reader
+	remaining int64
+	limited   bool
+	exceeded  bool
+}
+
+func (l *limitedReader) Read(p []byte) (n int, err error) {
+	if !l.limited {
+		if l.remaining <= 0 {
+			return l.r.Read(p)
+		}
+		l.limited = true
+	}
+	if l.exceeded {
+		return 0, errTooLarge
+	}
+	if int64(len(p)) > l.remaining+1 {
+		p = p[:l.remaining+1]
+	}
+	n, err = l.r.Read(p)
+	if int64(n) > l.remaining {
+		l.exceeded = true
+		return int(l.remaining), errTooLarge
+	}
+	l.remaining -= int64(n)
+	return n, err
+}
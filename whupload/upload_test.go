@@ -0,0 +1,106 @@
+// Copyright (C) 2017 JT Olds
+// See LICENSE for copying information
+
+package whupload_test
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"gopkg.in/webhelp.v1/wherr"
+	"gopkg.in/webhelp.v1/whupload"
+)
+
+var png = "\x89PNG\r\n\x1a\n" + strings.Repeat("\x00", 100)
+
+type part struct {
+	field, filename, contents string
+}
+
+func request(t *testing.T, parts ...part) *http.Request {
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	for _, p := range parts {
+		var pw io.Writer
+		var err error
+		if p.filename == "" {
+			pw, err = w.CreateFormField(p.field)
+		} else {
+			pw, err = w.CreateFormFile(p.field, p.filename)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.WriteString(pw, p.contents)
+	}
+	w.Close()
+	r := httptest.NewRequest("POST", "/", &body)
+	r.Header.Set("Content-Type", w.FormDataContentType())
+	return r
+}
+
+func TestProcess(t *testing.T) {
+	u := whupload.Uploader{MaxFileSize: 1000, MaxTotalSize: 1500, MaxFiles: 2,
+		AllowedTypes: []string{"image/*"}}
+
+	var got []string
+	vals, err := u.Process(request(t,
+		part{field: "title", contents: "hi"},
+		part{field: "a", filename: "a.png", contents: png},
+		part{field: "b", filename: "b.txt", contents: png}),
+		func(f *whupload.File, body io.Reader) error {
+			data, err := ioutil.ReadAll(body)
+			if err != nil {
+				return err
+			}
+			if string(data) != png {
+				t.Fatalf("unexpected contents for %s", f.FileName)
+			}
+			got = append(got, f.FieldName+":"+f.FileName+":"+f.ContentType+
+				":"+f.DeclaredType)
+			return nil
+		})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if vals.Get("title") != "hi" {
+		t.Fatalf("unexpected values: %v", vals)
+	}
+	if strings.Join(got, ",") != "a:a.png:image/png:application/octet-stream,"+
+		"b:b.txt:image/png:application/octet-stream" {
+		t.Fatalf("unexpected files: %v", got)
+	}
+
+	discard := func(f *whupload.File, body io.Reader) error { return nil }
+	for _, test := range []struct {
+		parts  []part
+		status int
+	}{
+		{[]part{{"a", "a.png", png + strings.Repeat("x", 1000)}},
+			http.StatusRequestEntityTooLarge},
+		{[]part{{"a", "a.png", png + strings.Repeat("x", 800)},
+			{"b", "b.png", png + strings.Repeat("x", 800)}},
+			http.StatusRequestEntityTooLarge},
+		{[]part{{"a", "a.png", png}, {"b", "b.png", png}, {"c", "c.png", png}},
+			http.StatusRequestEntityTooLarge},
+		{[]part{{"a", "a.png", "plain text"}},
+			http.StatusUnsupportedMediaType},
+	} {
+		_, err := u.Process(request(t, test.parts...), discard)
+		if wherr.StatusCode(err) != test.status {
+			t.Fatalf("expected %d, got %v", test.status, err)
+		}
+	}
+
+	_, err = u.Process(httptest.NewRequest("POST", "/",
+		strings.NewReader("{}")), discard)
+	if wherr.StatusCode(err) != http.StatusUnsupportedMediaType {
+		t.Fatalf("expected unsupported media type, got %v", err)
+	}
+}